@@ -1,39 +1,92 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/codecrafters-io/interpreter-starter-go/internal/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/compiler"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/diagnostics"
 	"github.com/codecrafters-io/interpreter-starter-go/internal/interpreter"
 	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/repl"
 	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
 	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/vm"
 )
 
+const usage = "Usage: ./your_program.sh <tokenize|parse|evaluate|run> [--color=auto|always|never] [--backend=tree|vm] [--max-depth=N] [--timeout=DURATION] [--max-steps=N] [--allow-fs] [--allow-env] <filename> [args...]\n" +
+	"       ./your_program.sh repl [--color=auto|always|never]"
+
+// exitBudget is the exit code for programs stopped by --timeout or
+// --max-steps, as timeout(1) uses.
+const exitBudget = 124
+
+// stdout buffers program output. It is flushed by exit and when main
+// returns.
+var stdout = bufio.NewWriter(os.Stdout)
+
 func main() {
-	if len(os.Args) < 3 {
-		fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh tokenize <filename>")
-		os.Exit(1)
+	defer stdout.Flush()
+
+	if len(os.Args) < 2 || (len(os.Args) < 3 && os.Args[1] != "repl") {
+		fmt.Fprintln(os.Stderr, usage)
+		exit(1)
 	}
 
 	command := os.Args[1]
 
-	if command == "tokenize" {
-		filename := os.Args[2]
-		fileContents, err := os.ReadFile(filename)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
-			os.Exit(1)
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	colorFlag := flags.String("color", "auto", "colorize diagnostics: auto, always or never")
+	backend := flags.String("backend", "tree", "execution backend for run: tree or vm; the vm can't run programs that import modules")
+	maxDepth := flags.Int("max-depth", interpreter.DEFAULT_MAX_DEPTH, fmt.Sprintf("maximum number of active Lox calls, at most %d", interpreter.MAX_DEPTH))
+	timeout := flags.Duration("timeout", 0, "stop run after this long, e.g. 2s, including time spent waiting for input; 0 means no limit")
+	maxSteps := flags.Int("max-steps", 0, "stop run after this many loop iterations and calls to Lox functions and classes; other statements and natives aren't counted; 0 means no limit")
+	allowFS := flags.Bool("allow-fs", false, "let run read and write files")
+	allowEnv := flags.Bool("allow-env", false, "let run read environment variables")
+	flags.Parse(os.Args[2:])
+
+	colorMode, err := diagnostics.ParseColorMode(*colorFlag)
+	if err != nil || (*backend != "tree" && *backend != "vm") || *maxDepth < 1 || *maxDepth > interpreter.MAX_DEPTH || *timeout < 0 || *maxSteps < 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		exit(1)
+	}
+
+	if command == "repl" {
+		if err := repl.Run(os.Stdin, os.Stdout, os.Stderr, colorMode, historyPath()); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			exit(1)
 		}
+		return
+	}
+
+	if flags.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		exit(1)
+	}
+
+	filename := flags.Arg(0)
+	fileContents, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		exit(1)
+	}
+
+	diagnostics := diagnostics.NewRenderer(os.Stderr, string(fileContents), colorMode)
 
+	if command == "tokenize" {
 		scanner := scanner.NewScanner(string(fileContents))
 		hadError := false
 		for {
 			t, err := scanner.Scan()
 			if err != nil {
 				hadError = true
-				fmt.Fprintf(os.Stderr, "%v\n", err)
+				diagnostics.Report(err)
 				continue
 			}
 
@@ -41,7 +94,7 @@ func main() {
 				continue
 			}
 
-			fmt.Println(t)
+			fmt.Fprintln(stdout, t)
 
 			if t.Type == token.EOF {
 				break
@@ -49,105 +102,194 @@ func main() {
 		}
 
 		if hadError {
-			os.Exit(65)
+			exit(65)
 		}
 	} else if command == "parse" {
-		filename := os.Args[2]
-		fileContents, err := os.ReadFile(filename)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
-			os.Exit(1)
-		}
-
 		scanner := scanner.NewScanner(string(fileContents))
 		tokens, err := scanner.ScanTokens()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
-			os.Exit(65)
+			diagnostics.Report(err)
+			exit(65)
 		}
 
 		parser := parser.NewParser(tokens)
 		astPrinter := &ast.AstPrinter{}
-		nodes := parser.ParseExpressions()
-		if parser.HadError {
-			os.Exit(65)
+		nodes, parseErrors := parser.ParseExpressions()
+		if len(parseErrors) > 0 {
+			reportParseErrors(diagnostics, parseErrors)
+			exit(65)
 		}
 
 		for _, node := range nodes {
 			str, _ := node.Accept(astPrinter)
-			fmt.Println(str)
+			fmt.Fprintln(stdout, str)
 		}
 
 	} else if command == "evaluate" {
-		filename := os.Args[2]
-		fileContents, err := os.ReadFile(filename)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
-			os.Exit(1)
-		}
-
 		scanner := scanner.NewScanner(string(fileContents))
 		tokens, err := scanner.ScanTokens()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
-			os.Exit(65)
+			diagnostics.Report(err)
+			exit(65)
 		}
 
 		parser := parser.NewParser(tokens)
-		nodes := parser.ParseExpressions()
-		if parser.HadError {
-			os.Exit(65)
+		nodes, parseErrors := parser.ParseExpressions()
+		if len(parseErrors) > 0 {
+			reportParseErrors(diagnostics, parseErrors)
+			exit(65)
+		}
+
+		interpreterInstance := interpreter.NewInterpreter()
+		interpreterInstance.SetStdout(stdout)
+		resolver := interpreter.NewResolver(interpreterInstance)
+		for _, node := range nodes {
+			if _, err := resolver.Resolve([]ast.Stmt{&ast.ExpressionStmt{Expr: node}}); err != nil {
+				diagnostics.Report(err)
+				exit(65)
+			}
 		}
 
-		interpreter := interpreter.Interpreter{}
 		for _, node := range nodes {
-			val, err := node.Accept(&interpreter)
+			val, err := interpreterInstance.Interpret(node)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "%v\n", err)
-				os.Exit(70)
+				stdout.Flush()
+				diagnostics.Report(err)
+				exit(70)
 			} else if val == nil {
-				fmt.Println("nil")
+				fmt.Fprintln(stdout, "nil")
 			} else {
-				fmt.Println(val)
+				fmt.Fprintln(stdout, val)
 			}
 		}
 	} else if command == "run" {
-		filename := os.Args[2]
-		fileContents, err := os.ReadFile(filename)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
-			os.Exit(1)
-		}
-
 		scanner := scanner.NewScanner(string(fileContents))
 		tokens, err := scanner.ScanTokens()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
-			os.Exit(65)
+			diagnostics.Report(err)
+			exit(65)
 		}
 
 		parser := parser.NewParser(tokens)
-		nodes := parser.Parse()
-		if parser.HadError {
-			os.Exit(65)
+		nodes, parseErrors := parser.Parse()
+		if len(parseErrors) > 0 {
+			reportParseErrors(diagnostics, parseErrors)
+			exit(65)
 		}
 
+		system := interpreter.System(interpreter.SystemOptions{
+			Stdin:    os.Stdin,
+			Stdout:   stdout,
+			Args:     flags.Args()[1:],
+			AllowFS:  *allowFS,
+			AllowEnv: *allowEnv,
+		})
+
 		interpreterInstance := interpreter.NewInterpreter()
+		interpreterInstance.Install(system)
+		interpreterInstance.SetStdout(stdout)
+		interpreterInstance.SetScriptPath(filename)
+		interpreterInstance.SetMaxDepth(*maxDepth)
+		interpreterInstance.SetMaxSteps(*maxSteps)
 		resolver := interpreter.NewResolver(interpreterInstance)
 		_, err = resolver.Resolve(nodes)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
-			os.Exit(65)
+			diagnostics.Report(err)
+			exit(65)
+		}
+
+		ctx := context.Background()
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
 		}
 
+		if *backend == "vm" {
+			script, err := compiler.Compile(nodes)
+			if err != nil {
+				diagnostics.Report(err)
+				exit(65)
+			}
+
+			machine := vm.NewVM()
+			machine.Install(system)
+			machine.SetStdout(stdout)
+			machine.SetMaxDepth(*maxDepth)
+			machine.SetMaxSteps(*maxSteps)
+			machine.SetContext(ctx)
+			if err := machine.Interpret(script); err != nil {
+				if code, ok := exitRequested(err); ok {
+					exit(code)
+				}
+				stdout.Flush()
+				diagnostics.Report(err)
+				exit(runtimeExitCode(err))
+			}
+			return
+		}
+
+		interpreterInstance.SetContext(ctx)
 		for _, node := range nodes {
 			val, err := node.Accept(&interpreterInstance)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "%v\n", err)
-				os.Exit(70)
+				if code, ok := exitRequested(err); ok {
+					exit(code)
+				}
+				stdout.Flush()
+				diagnostics.Report(err)
+				exit(runtimeExitCode(err))
 			} else if val != nil {
-				fmt.Println(val)
+				fmt.Fprintln(stdout, val)
 			}
 		}
+	} else {
+		fmt.Fprintln(os.Stderr, usage)
+		exit(1)
+	}
+}
+
+// exit flushes buffered output before terminating with code, since deferred
+// calls do not run on os.Exit.
+func exit(code int) {
+	stdout.Flush()
+	os.Exit(code)
+}
+
+func runtimeExitCode(err error) int {
+	var budgetErr interpreter.BudgetError
+	if errors.As(err, &budgetErr) {
+		return exitBudget
+	}
+	return 70
+}
+
+// exitRequested reports whether err is a call to the exit native, and with
+// which code.
+func exitRequested(err error) (int, bool) {
+	var exitErr interpreter.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code, true
+	}
+	return 0, false
+}
+
+func reportParseErrors(diagnostics *diagnostics.Renderer, errors []parser.ParseError) {
+	for _, err := range errors {
+		diagnostics.Report(err)
+	}
+}
+
+// historyPath is where the REPL keeps its history: $LOX_HISTORY if set,
+// otherwise .lox_history in the home directory.
+func historyPath() string {
+	if path, ok := os.LookupEnv("LOX_HISTORY"); ok {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
 	}
+	return filepath.Join(home, ".lox_history")
 }
@@ -20,6 +20,11 @@ type ExprVisitor interface {
 	VisitSetExpr(*SetExpr) (any, error)
 	VisitThisExpr(*ThisExpr) (any, error)
 	VisitSuperExpr(*SuperExpr) (any, error)
+	VisitFunctionExpr(*FunctionExpr) (any, error)
+	VisitListExpr(*ListExpr) (any, error)
+	VisitMapExpr(*MapExpr) (any, error)
+	VisitIndexExpr(*IndexExpr) (any, error)
+	VisitIndexSetExpr(*IndexSetExpr) (any, error)
 }
 
 type StmtVisitor interface {
@@ -29,9 +34,15 @@ type StmtVisitor interface {
 	VisitBlockStmt(*BlockStmt) (any, error)
 	VisitIfStmt(*IfStmt) (any, error)
 	VisitWhileStmt(*WhileStmt) (any, error)
+	VisitBreakStmt(*BreakStmt) (any, error)
+	VisitContinueStmt(*ContinueStmt) (any, error)
 	VisitFunctionStmt(*FunctionStmt) (any, error)
 	VisitReturnStmt(*ReturnStmt) (any, error)
 	VisitClassStmt(*ClassStmt) (any, error)
+	VisitThrowStmt(*ThrowStmt) (any, error)
+	VisitTryStmt(*TryStmt) (any, error)
+	VisitImportStmt(*ImportStmt) (any, error)
+	VisitExportStmt(*ExportStmt) (any, error)
 }
 
 type AstPrinter struct {
@@ -61,6 +72,14 @@ func (p *AstPrinter) VisitWhileStmt(s *WhileStmt) (any, error) {
 	return nil, nil
 }
 
+func (p *AstPrinter) VisitBreakStmt(s *BreakStmt) (any, error) {
+	return nil, nil
+}
+
+func (p *AstPrinter) VisitContinueStmt(s *ContinueStmt) (any, error) {
+	return nil, nil
+}
+
 func (p *AstPrinter) VisitFunctionStmt(s *FunctionStmt) (any, error) {
 	return nil, nil
 }
@@ -69,6 +88,22 @@ func (p *AstPrinter) VisitClassStmt(s *ClassStmt) (any, error) {
 	return nil, nil
 }
 
+func (p *AstPrinter) VisitThrowStmt(s *ThrowStmt) (any, error) {
+	return nil, nil
+}
+
+func (p *AstPrinter) VisitTryStmt(s *TryStmt) (any, error) {
+	return nil, nil
+}
+
+func (p *AstPrinter) VisitImportStmt(s *ImportStmt) (any, error) {
+	return nil, nil
+}
+
+func (p *AstPrinter) VisitExportStmt(s *ExportStmt) (any, error) {
+	return nil, nil
+}
+
 func (p *AstPrinter) VisitLiteralExpr(e *LiteralExpr) (any, error) {
 	if e.Value == nil {
 		return "nil", nil
@@ -158,3 +193,67 @@ func (p *AstPrinter) VisitThisExpr(e *ThisExpr) (any, error) {
 func (p *AstPrinter) VisitSuperExpr(e *SuperExpr) (any, error) {
 	return fmt.Sprintf("This [Line %d]", e.Keyword.Line), nil
 }
+
+func (p *AstPrinter) VisitFunctionExpr(e *FunctionExpr) (any, error) {
+	params := make([]string, len(e.Parameters))
+	for i, param := range e.Parameters {
+		params[i] = param.Lexeme
+	}
+	return fmt.Sprintf("(fun (%s))", strings.Join(params, " ")), nil
+}
+
+func (p *AstPrinter) VisitListExpr(e *ListExpr) (any, error) {
+	elements := []string{"list"}
+	for _, element := range e.Elements {
+		str, err := element.Accept(p)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, str.(string))
+	}
+	return fmt.Sprintf("(%s)", strings.Join(elements, " ")), nil
+}
+
+func (p *AstPrinter) VisitMapExpr(e *MapExpr) (any, error) {
+	entries := []string{"map"}
+	for i, key := range e.Keys {
+		keyStr, err := key.Accept(p)
+		if err != nil {
+			return nil, err
+		}
+		valueStr, err := e.Values[i].Accept(p)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fmt.Sprintf("(%v %v)", keyStr, valueStr))
+	}
+	return fmt.Sprintf("(%s)", strings.Join(entries, " ")), nil
+}
+
+func (p *AstPrinter) VisitIndexExpr(e *IndexExpr) (any, error) {
+	objectStr, err := e.Object.Accept(p)
+	if err != nil {
+		return nil, err
+	}
+	indexStr, err := e.Index.Accept(p)
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("(index %v %v)", objectStr, indexStr), nil
+}
+
+func (p *AstPrinter) VisitIndexSetExpr(e *IndexSetExpr) (any, error) {
+	objectStr, err := e.Object.Accept(p)
+	if err != nil {
+		return nil, err
+	}
+	indexStr, err := e.Index.Accept(p)
+	if err != nil {
+		return nil, err
+	}
+	valueStr, err := e.Value.Accept(p)
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("(= %v[%v] %v)", objectStr, indexStr, valueStr), nil
+}
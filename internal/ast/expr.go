@@ -6,9 +6,11 @@ import (
 
 type Expr interface {
 	Accept(ExprVisitor) (any, error)
+	Span() token.Span
 }
 
 type LiteralExpr struct {
+	Token token.Token
 	Value any
 }
 
@@ -16,14 +18,24 @@ func (e *LiteralExpr) Accept(v ExprVisitor) (any, error) {
 	return v.VisitLiteralExpr(e)
 }
 
+func (e *LiteralExpr) Span() token.Span {
+	return e.Token.Span()
+}
+
 type GroupingExpr struct {
-	Expr Expr
+	LeftParen  token.Token
+	Expr       Expr
+	RightParen token.Token
 }
 
 func (e *GroupingExpr) Accept(v ExprVisitor) (any, error) {
 	return v.VisitGroupingExpr(e)
 }
 
+func (e *GroupingExpr) Span() token.Span {
+	return e.LeftParen.Span().Join(spanOf(e.Expr)).Join(e.RightParen.Span())
+}
+
 type UnaryExpr struct {
 	Operator token.Token
 	Right    Expr
@@ -33,6 +45,10 @@ func (e *UnaryExpr) Accept(v ExprVisitor) (any, error) {
 	return v.VisitUnaryExpr(e)
 }
 
+func (e *UnaryExpr) Span() token.Span {
+	return e.Operator.Span().Join(spanOf(e.Right))
+}
+
 type BinaryExpr struct {
 	Left     Expr
 	Operator token.Token
@@ -43,6 +59,10 @@ func (e *BinaryExpr) Accept(v ExprVisitor) (any, error) {
 	return v.VisitBinaryExpr(e)
 }
 
+func (e *BinaryExpr) Span() token.Span {
+	return spanOf(e.Left).Join(e.Operator.Span()).Join(spanOf(e.Right))
+}
+
 type VariableExpr struct {
 	Name token.Token
 }
@@ -51,6 +71,10 @@ func (e *VariableExpr) Accept(v ExprVisitor) (any, error) {
 	return v.VisitVariableExpr(e)
 }
 
+func (e *VariableExpr) Span() token.Span {
+	return e.Name.Span()
+}
+
 type AssignmentExpr struct {
 	Name  token.Token
 	Value Expr
@@ -60,6 +84,10 @@ func (e *AssignmentExpr) Accept(v ExprVisitor) (any, error) {
 	return v.VisitAssignmentExpr(e)
 }
 
+func (e *AssignmentExpr) Span() token.Span {
+	return e.Name.Span().Join(spanOf(e.Value))
+}
+
 type LogicalExpr struct {
 	Left     Expr
 	Operator token.Token
@@ -70,6 +98,10 @@ func (e *LogicalExpr) Accept(v ExprVisitor) (any, error) {
 	return v.VisitLogicalExpr(e)
 }
 
+func (e *LogicalExpr) Span() token.Span {
+	return spanOf(e.Left).Join(e.Operator.Span()).Join(spanOf(e.Right))
+}
+
 type CallExpr struct {
 	Callee    Expr
 	Paren     token.Token
@@ -80,6 +112,10 @@ func (e *CallExpr) Accept(v ExprVisitor) (any, error) {
 	return v.VisitCallExpr(e)
 }
 
+func (e *CallExpr) Span() token.Span {
+	return spanOf(e.Callee).Join(e.Paren.Span())
+}
+
 type GetExpr struct {
 	Object Expr
 	Name   token.Token
@@ -89,6 +125,10 @@ func (e *GetExpr) Accept(v ExprVisitor) (any, error) {
 	return v.VisitGetExpr(e)
 }
 
+func (e *GetExpr) Span() token.Span {
+	return spanOf(e.Object).Join(e.Name.Span())
+}
+
 type SetExpr struct {
 	Name   token.Token
 	Object Expr
@@ -99,6 +139,71 @@ func (e *SetExpr) Accept(v ExprVisitor) (any, error) {
 	return v.VisitSetExpr(e)
 }
 
+func (e *SetExpr) Span() token.Span {
+	return spanOf(e.Object).Join(e.Name.Span()).Join(spanOf(e.Value))
+}
+
+type ListExpr struct {
+	LeftBracket  token.Token
+	Elements     []Expr
+	RightBracket token.Token
+}
+
+func (e *ListExpr) Accept(v ExprVisitor) (any, error) {
+	return v.VisitListExpr(e)
+}
+
+func (e *ListExpr) Span() token.Span {
+	return e.LeftBracket.Span().Join(e.RightBracket.Span())
+}
+
+// MapExpr is a map literal. Keys and Values hold the entries in source
+// order.
+type MapExpr struct {
+	LeftBrace  token.Token
+	Keys       []Expr
+	Values     []Expr
+	RightBrace token.Token
+}
+
+func (e *MapExpr) Accept(v ExprVisitor) (any, error) {
+	return v.VisitMapExpr(e)
+}
+
+func (e *MapExpr) Span() token.Span {
+	return e.LeftBrace.Span().Join(e.RightBrace.Span())
+}
+
+type IndexExpr struct {
+	Object       Expr
+	Bracket      token.Token
+	Index        Expr
+	RightBracket token.Token
+}
+
+func (e *IndexExpr) Accept(v ExprVisitor) (any, error) {
+	return v.VisitIndexExpr(e)
+}
+
+func (e *IndexExpr) Span() token.Span {
+	return spanOf(e.Object).Join(e.RightBracket.Span())
+}
+
+type IndexSetExpr struct {
+	Object  Expr
+	Bracket token.Token
+	Index   Expr
+	Value   Expr
+}
+
+func (e *IndexSetExpr) Accept(v ExprVisitor) (any, error) {
+	return v.VisitIndexSetExpr(e)
+}
+
+func (e *IndexSetExpr) Span() token.Span {
+	return spanOf(e.Object).Join(spanOf(e.Value))
+}
+
 type ThisExpr struct {
 	Keyword token.Token
 }
@@ -107,6 +212,10 @@ func (e *ThisExpr) Accept(v ExprVisitor) (any, error) {
 	return v.VisitThisExpr(e)
 }
 
+func (e *ThisExpr) Span() token.Span {
+	return e.Keyword.Span()
+}
+
 type SuperExpr struct {
 	Keyword token.Token
 	Method  token.Token
@@ -115,3 +224,31 @@ type SuperExpr struct {
 func (e *SuperExpr) Accept(v ExprVisitor) (any, error) {
 	return v.VisitSuperExpr(e)
 }
+
+func (e *SuperExpr) Span() token.Span {
+	return e.Keyword.Span().Join(e.Method.Span())
+}
+
+func spanOf(node interface{ Span() token.Span }) token.Span {
+	if node == nil {
+		return token.Span{}
+	}
+	return node.Span()
+}
+
+// FunctionExpr is an anonymous function, fun (a, b) { ... }, used as a
+// value.
+type FunctionExpr struct {
+	Keyword    token.Token
+	Parameters []token.Token
+	Body       []Stmt
+	RightBrace token.Token
+}
+
+func (e *FunctionExpr) Accept(v ExprVisitor) (any, error) {
+	return v.VisitFunctionExpr(e)
+}
+
+func (e *FunctionExpr) Span() token.Span {
+	return e.Keyword.Span().Join(e.RightBrace.Span())
+}
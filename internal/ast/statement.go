@@ -6,42 +6,71 @@ import (
 
 type Stmt interface {
 	Accept(StmtVisitor) (any, error)
+	Span() token.Span
 }
 
 type PrintStmt struct {
-	Expr Expr
+	Keyword   token.Token
+	Expr      Expr
+	Semicolon token.Token
 }
 
 func (s *PrintStmt) Accept(v StmtVisitor) (any, error) {
 	return v.VisitPrintStmt(s)
 }
 
+func (s *PrintStmt) Span() token.Span {
+	return s.Keyword.Span().Join(spanOf(s.Expr)).Join(s.Semicolon.Span())
+}
+
 type ExpressionStmt struct {
-	Expr Expr
+	Expr      Expr
+	Semicolon token.Token
 }
 
 func (s *ExpressionStmt) Accept(v StmtVisitor) (any, error) {
 	return v.VisitExpressionStmt(s)
 }
 
+func (s *ExpressionStmt) Span() token.Span {
+	return spanOf(s.Expr).Join(s.Semicolon.Span())
+}
+
 type VarStmt struct {
+	Keyword     token.Token
 	Name        token.Token
 	Initializer Expr
+	Semicolon   token.Token
 }
 
 func (s *VarStmt) Accept(v StmtVisitor) (any, error) {
 	return v.VisitVarStmt(s)
 }
 
+func (s *VarStmt) Span() token.Span {
+	return s.Keyword.Span().Join(s.Name.Span()).Join(spanOf(s.Initializer)).Join(s.Semicolon.Span())
+}
+
 type BlockStmt struct {
+	LeftBrace  token.Token
 	Statements []Stmt
+	RightBrace token.Token
 }
 
 func (s *BlockStmt) Accept(v StmtVisitor) (any, error) {
 	return v.VisitBlockStmt(s)
 }
 
+func (s *BlockStmt) Span() token.Span {
+	span := s.LeftBrace.Span()
+	for _, stmt := range s.Statements {
+		span = span.Join(spanOf(stmt))
+	}
+	return span.Join(s.RightBrace.Span())
+}
+
 type IfStmt struct {
+	Keyword    token.Token
 	Condition  Expr
 	ThenBranch Stmt
 	ElseBranch Stmt
@@ -51,40 +80,169 @@ func (s *IfStmt) Accept(v StmtVisitor) (any, error) {
 	return v.VisitIfStmt(s)
 }
 
+func (s *IfStmt) Span() token.Span {
+	return s.Keyword.Span().Join(spanOf(s.Condition)).Join(spanOf(s.ThenBranch)).Join(spanOf(s.ElseBranch))
+}
+
+// WhileStmt is both a while loop and a desugared for loop. Increment is
+// the for loop's increment clause, or nil; it runs after the body, also
+// when the body continues.
 type WhileStmt struct {
+	Keyword   token.Token
 	Condition Expr
 	Body      Stmt
+	Increment Expr
 }
 
 func (s *WhileStmt) Accept(v StmtVisitor) (any, error) {
 	return v.VisitWhileStmt(s)
 }
 
+func (s *WhileStmt) Span() token.Span {
+	return s.Keyword.Span().Join(spanOf(s.Condition)).Join(spanOf(s.Increment)).Join(spanOf(s.Body))
+}
+
+type BreakStmt struct {
+	Keyword   token.Token
+	Semicolon token.Token
+}
+
+func (s *BreakStmt) Accept(v StmtVisitor) (any, error) {
+	return v.VisitBreakStmt(s)
+}
+
+func (s *BreakStmt) Span() token.Span {
+	return s.Keyword.Span().Join(s.Semicolon.Span())
+}
+
+type ContinueStmt struct {
+	Keyword   token.Token
+	Semicolon token.Token
+}
+
+func (s *ContinueStmt) Accept(v StmtVisitor) (any, error) {
+	return v.VisitContinueStmt(s)
+}
+
+func (s *ContinueStmt) Span() token.Span {
+	return s.Keyword.Span().Join(s.Semicolon.Span())
+}
+
 type FunctionStmt struct {
+	Keyword    token.Token
 	Name       token.Token
 	Parameters []token.Token
 	Body       []Stmt
+	RightBrace token.Token
 }
 
 func (s *FunctionStmt) Accept(v StmtVisitor) (any, error) {
 	return v.VisitFunctionStmt(s)
 }
 
+func (s *FunctionStmt) Span() token.Span {
+	return s.Keyword.Span().Join(s.Name.Span()).Join(s.RightBrace.Span())
+}
+
 type ReturnStmt struct {
-	Value   Expr
-	Keyword token.Token
+	Value     Expr
+	Keyword   token.Token
+	Semicolon token.Token
 }
 
 func (s *ReturnStmt) Accept(v StmtVisitor) (any, error) {
 	return v.VisitReturnStmt(s)
 }
 
+func (s *ReturnStmt) Span() token.Span {
+	return s.Keyword.Span().Join(spanOf(s.Value)).Join(s.Semicolon.Span())
+}
+
 type ClassStmt struct {
+	Keyword    token.Token
 	Name       token.Token
 	Superclass *VariableExpr
 	Methods    []FunctionStmt
+	RightBrace token.Token
 }
 
 func (s *ClassStmt) Accept(v StmtVisitor) (any, error) {
 	return v.VisitClassStmt(s)
 }
+
+func (s *ClassStmt) Span() token.Span {
+	return s.Keyword.Span().Join(s.Name.Span()).Join(s.RightBrace.Span())
+}
+
+type ThrowStmt struct {
+	Keyword   token.Token
+	Value     Expr
+	Semicolon token.Token
+}
+
+func (s *ThrowStmt) Accept(v StmtVisitor) (any, error) {
+	return v.VisitThrowStmt(s)
+}
+
+func (s *ThrowStmt) Span() token.Span {
+	return s.Keyword.Span().Join(spanOf(s.Value)).Join(s.Semicolon.Span())
+}
+
+// TryStmt has a catch clause, a finally clause, or both. Catch and Finally
+// are nil when the clause is missing.
+type TryStmt struct {
+	Keyword   token.Token
+	Body      *BlockStmt
+	CatchName token.Token
+	Catch     *BlockStmt
+	Finally   *BlockStmt
+}
+
+func (s *TryStmt) Accept(v StmtVisitor) (any, error) {
+	return v.VisitTryStmt(s)
+}
+
+func (s *TryStmt) Span() token.Span {
+	span := s.Keyword.Span().Join(s.Body.Span())
+	if s.Catch != nil {
+		span = span.Join(s.Catch.Span())
+	}
+	if s.Finally != nil {
+		span = span.Join(s.Finally.Span())
+	}
+	return span
+}
+
+// ImportStmt is either `import "path" as Alias;`, which binds the module
+// itself, or `from "path" import a, b;`, which binds names it exports.
+// Keyword is the from identifier in the second form, where Alias is zero.
+type ImportStmt struct {
+	Keyword   token.Token
+	Path      token.Token
+	Alias     token.Token
+	Names     []token.Token
+	Semicolon token.Token
+}
+
+func (s *ImportStmt) Accept(v StmtVisitor) (any, error) {
+	return v.VisitImportStmt(s)
+}
+
+func (s *ImportStmt) Span() token.Span {
+	return s.Keyword.Span().Join(s.Semicolon.Span())
+}
+
+// ExportStmt marks a top-level var, fun or class declaration as importable
+// from other modules.
+type ExportStmt struct {
+	Keyword     token.Token
+	Declaration Stmt
+}
+
+func (s *ExportStmt) Accept(v StmtVisitor) (any, error) {
+	return v.VisitExportStmt(s)
+}
+
+func (s *ExportStmt) Span() token.Span {
+	return s.Keyword.Span().Join(s.Declaration.Span())
+}
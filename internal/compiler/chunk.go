@@ -0,0 +1,167 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
+)
+
+type OpCode byte
+
+const (
+	OP_CONSTANT OpCode = iota
+	OP_NIL
+	OP_TRUE
+	OP_FALSE
+	OP_POP
+	OP_GET_LOCAL
+	OP_SET_LOCAL
+	OP_GET_GLOBAL
+	OP_DEFINE_GLOBAL
+	OP_SET_GLOBAL
+	OP_GET_UPVALUE
+	OP_SET_UPVALUE
+	OP_GET_PROPERTY
+	OP_SET_PROPERTY
+	OP_CHECK_INSTANCE
+	OP_GET_SUPER
+	OP_EQUAL
+	OP_NOT_EQUAL
+	OP_GREATER
+	OP_GREATER_EQUAL
+	OP_LESS
+	OP_LESS_EQUAL
+	OP_ADD
+	OP_SUBTRACT
+	OP_MULTIPLY
+	OP_DIVIDE
+	OP_NOT
+	OP_NEGATE
+	OP_PRINT
+	OP_JUMP
+	OP_JUMP_IF_FALSE
+	OP_LOOP
+	OP_CALL
+	OP_CLOSURE
+	OP_CLOSE_UPVALUE
+	OP_RETURN
+	OP_CLASS
+	OP_INHERIT
+	OP_METHOD
+	OP_BUILD_LIST
+	OP_BUILD_MAP
+	OP_GET_INDEX
+	OP_SET_INDEX
+	OP_TRY
+	OP_TRY_FINALLY
+	OP_POP_HANDLER
+	OP_THROW
+	OP_RETHROW
+)
+
+var opNames = map[OpCode]string{
+	OP_CONSTANT:       "OP_CONSTANT",
+	OP_NIL:            "OP_NIL",
+	OP_TRUE:           "OP_TRUE",
+	OP_FALSE:          "OP_FALSE",
+	OP_POP:            "OP_POP",
+	OP_GET_LOCAL:      "OP_GET_LOCAL",
+	OP_SET_LOCAL:      "OP_SET_LOCAL",
+	OP_GET_GLOBAL:     "OP_GET_GLOBAL",
+	OP_DEFINE_GLOBAL:  "OP_DEFINE_GLOBAL",
+	OP_SET_GLOBAL:     "OP_SET_GLOBAL",
+	OP_GET_UPVALUE:    "OP_GET_UPVALUE",
+	OP_SET_UPVALUE:    "OP_SET_UPVALUE",
+	OP_GET_PROPERTY:   "OP_GET_PROPERTY",
+	OP_SET_PROPERTY:   "OP_SET_PROPERTY",
+	OP_CHECK_INSTANCE: "OP_CHECK_INSTANCE",
+	OP_GET_SUPER:      "OP_GET_SUPER",
+	OP_EQUAL:          "OP_EQUAL",
+	OP_NOT_EQUAL:      "OP_NOT_EQUAL",
+	OP_GREATER:        "OP_GREATER",
+	OP_GREATER_EQUAL:  "OP_GREATER_EQUAL",
+	OP_LESS:           "OP_LESS",
+	OP_LESS_EQUAL:     "OP_LESS_EQUAL",
+	OP_ADD:            "OP_ADD",
+	OP_SUBTRACT:       "OP_SUBTRACT",
+	OP_MULTIPLY:       "OP_MULTIPLY",
+	OP_DIVIDE:         "OP_DIVIDE",
+	OP_NOT:            "OP_NOT",
+	OP_NEGATE:         "OP_NEGATE",
+	OP_PRINT:          "OP_PRINT",
+	OP_JUMP:           "OP_JUMP",
+	OP_JUMP_IF_FALSE:  "OP_JUMP_IF_FALSE",
+	OP_LOOP:           "OP_LOOP",
+	OP_CALL:           "OP_CALL",
+	OP_CLOSURE:        "OP_CLOSURE",
+	OP_CLOSE_UPVALUE:  "OP_CLOSE_UPVALUE",
+	OP_RETURN:         "OP_RETURN",
+	OP_CLASS:          "OP_CLASS",
+	OP_INHERIT:        "OP_INHERIT",
+	OP_METHOD:         "OP_METHOD",
+	OP_BUILD_LIST:     "OP_BUILD_LIST",
+	OP_BUILD_MAP:      "OP_BUILD_MAP",
+	OP_GET_INDEX:      "OP_GET_INDEX",
+	OP_SET_INDEX:      "OP_SET_INDEX",
+	OP_TRY:            "OP_TRY",
+	OP_TRY_FINALLY:    "OP_TRY_FINALLY",
+	OP_POP_HANDLER:    "OP_POP_HANDLER",
+	OP_THROW:          "OP_THROW",
+	OP_RETHROW:        "OP_RETHROW",
+}
+
+func (op OpCode) String() string {
+	if name, ok := opNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("OP_UNKNOWN(%d)", byte(op))
+}
+
+// Chunk is a compiled sequence of instructions. Spans holds the source span
+// of every byte in Code so runtime errors can report where they happened.
+type Chunk struct {
+	Code      []byte
+	Spans     []token.Span
+	Constants []any
+}
+
+// OPERAND_SIZE is how many bytes, big-endian, every multi-valued operand
+// takes: constant indexes, local and upvalue slots, jump offsets and
+// element counts. Three bytes let the vm run programs far larger than any
+// the tree-walking interpreter handles in practice.
+const OPERAND_SIZE = 3
+
+// MAX_OPERAND is the largest value an operand holds.
+const MAX_OPERAND = 1<<(8*OPERAND_SIZE) - 1
+
+// ReadOperand returns the operand starting at offset in code.
+func ReadOperand(code []byte, offset int) int {
+	return int(code[offset])<<16 | int(code[offset+1])<<8 | int(code[offset+2])
+}
+
+func (c *Chunk) write(b byte, span token.Span) {
+	c.Code = append(c.Code, b)
+	c.Spans = append(c.Spans, span)
+}
+
+func (c *Chunk) addConstant(value any) int {
+	c.Constants = append(c.Constants, value)
+	return len(c.Constants) - 1
+}
+
+// Function is the compiled form of a Lox function body, or of the top-level
+// script when Name is empty.
+type Function struct {
+	Name         string
+	ClassName    string // set for methods
+	Arity        int
+	UpvalueCount int
+	Chunk        Chunk
+}
+
+func (f *Function) String() string {
+	if f.Name == "" {
+		return "<script>"
+	}
+	return fmt.Sprintf("<fn %s>", f.Name)
+}
@@ -0,0 +1,1093 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
+)
+
+const (
+	maxLocals    = MAX_OPERAND + 1
+	maxUpvalues  = MAX_OPERAND + 1
+	maxConstants = MAX_OPERAND + 1
+	maxJump      = MAX_OPERAND
+	maxElements  = MAX_OPERAND
+)
+
+type CompileError struct {
+	Token   token.Token
+	Message string
+}
+
+func (e CompileError) Error() string {
+	return fmt.Sprintf("[line %d] Error at '%s': %s", e.Token.Line, e.Token.Lexeme, e.Message)
+}
+
+func (e CompileError) Span() token.Span {
+	return e.Token.Span()
+}
+
+type functionType int
+
+const (
+	SCRIPT functionType = iota
+	FUNCTION
+	METHOD
+	INITIALIZER
+)
+
+type local struct {
+	name       string
+	depth      int
+	isCaptured bool
+}
+
+type upvalue struct {
+	index   int
+	isLocal bool
+}
+
+type classCompiler struct {
+	enclosing     *classCompiler
+	name          string
+	hasSuperclass bool
+}
+
+// loopCompiler collects the jumps of break and continue statements until
+// the loop's exit and increment are known.
+type loopCompiler struct {
+	enclosing     *loopCompiler
+	scopeDepth    int
+	tries         *tryCompiler
+	breakJumps    []int
+	continueJumps []int
+}
+
+// tryCompiler tracks a try statement while its body or catch clause is
+// compiled. Return, break and continue statements that leave it must
+// remove its exception handler and run its finally clause first.
+type tryCompiler struct {
+	enclosing  *tryCompiler
+	finally    *ast.BlockStmt
+	scopeDepth int
+	loop       *loopCompiler
+	handler    bool
+}
+
+type Compiler struct {
+	enclosing    *Compiler
+	function     *Function
+	functionType functionType
+	locals       []local
+	upvalues     []upvalue
+	scopeDepth   int
+	currentClass *classCompiler
+	loop         *loopCompiler
+	tries        *tryCompiler
+	constants    map[any]int
+	token        token.Token
+}
+
+func newCompiler(enclosing *Compiler, functionType functionType, name string) *Compiler {
+	c := &Compiler{
+		enclosing:    enclosing,
+		function:     &Function{Name: name},
+		functionType: functionType,
+		locals:       make([]local, 0, 8),
+		constants:    make(map[any]int),
+	}
+	if enclosing != nil {
+		c.currentClass = enclosing.currentClass
+		c.token = enclosing.token
+	}
+
+	// Slot zero holds the callee, or the receiver for methods.
+	slotName := ""
+	if functionType == METHOD || functionType == INITIALIZER {
+		slotName = "this"
+	}
+	c.locals = append(c.locals, local{name: slotName, depth: 0})
+	return c
+}
+
+// Compile turns a resolved program into the function for its top-level
+// script.
+func Compile(statements []ast.Stmt) (*Function, error) {
+	c := newCompiler(nil, SCRIPT, "")
+	for _, stmt := range statements {
+		if err := c.stmt(stmt); err != nil {
+			return nil, err
+		}
+	}
+	c.emitReturn()
+	return c.function, nil
+}
+
+func (c *Compiler) VisitPrintStmt(s *ast.PrintStmt) (any, error) {
+	if err := c.expr(s.Expr); err != nil {
+		return nil, err
+	}
+	c.emitOp(OP_PRINT)
+	return nil, nil
+}
+
+func (c *Compiler) VisitExpressionStmt(s *ast.ExpressionStmt) (any, error) {
+	if err := c.expr(s.Expr); err != nil {
+		return nil, err
+	}
+	c.emitOp(OP_POP)
+	return nil, nil
+}
+
+func (c *Compiler) VisitVarStmt(s *ast.VarStmt) (any, error) {
+	c.token = s.Name
+	if err := c.declareVariable(s.Name); err != nil {
+		return nil, err
+	}
+
+	if s.Initializer != nil {
+		if err := c.expr(s.Initializer); err != nil {
+			return nil, err
+		}
+	} else {
+		c.emitOp(OP_NIL)
+	}
+
+	return nil, c.defineVariable(s.Name)
+}
+
+func (c *Compiler) VisitBlockStmt(s *ast.BlockStmt) (any, error) {
+	c.beginScope()
+	for _, stmt := range s.Statements {
+		if err := c.stmt(stmt); err != nil {
+			return nil, err
+		}
+	}
+	c.endScope()
+	return nil, nil
+}
+
+func (c *Compiler) VisitIfStmt(s *ast.IfStmt) (any, error) {
+	if err := c.expr(s.Condition); err != nil {
+		return nil, err
+	}
+
+	thenJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	if err := c.stmt(s.ThenBranch); err != nil {
+		return nil, err
+	}
+
+	elseJump := c.emitJump(OP_JUMP)
+	if err := c.patchJump(thenJump); err != nil {
+		return nil, err
+	}
+	c.emitOp(OP_POP)
+
+	if s.ElseBranch != nil {
+		if err := c.stmt(s.ElseBranch); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, c.patchJump(elseJump)
+}
+
+func (c *Compiler) VisitWhileStmt(s *ast.WhileStmt) (any, error) {
+	loopStart := len(c.chunk().Code)
+	if err := c.expr(s.Condition); err != nil {
+		return nil, err
+	}
+
+	exitJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+
+	loop := &loopCompiler{enclosing: c.loop, scopeDepth: c.scopeDepth, tries: c.tries}
+	c.loop = loop
+	err := c.stmt(s.Body)
+	c.loop = loop.enclosing
+	if err != nil {
+		return nil, err
+	}
+
+	for _, jump := range loop.continueJumps {
+		if err := c.patchJump(jump); err != nil {
+			return nil, err
+		}
+	}
+	if s.Increment != nil {
+		if err := c.expr(s.Increment); err != nil {
+			return nil, err
+		}
+		c.emitOp(OP_POP)
+	}
+	c.token = s.Keyword
+	if err := c.emitLoop(loopStart); err != nil {
+		return nil, err
+	}
+
+	if err := c.patchJump(exitJump); err != nil {
+		return nil, err
+	}
+	c.emitOp(OP_POP)
+
+	for _, jump := range loop.breakJumps {
+		if err := c.patchJump(jump); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitBreakStmt(s *ast.BreakStmt) (any, error) {
+	if err := c.leaveTries(c.loop.tries); err != nil {
+		return nil, err
+	}
+	c.token = s.Keyword
+	c.popLocals(c.loop.scopeDepth)
+	c.loop.breakJumps = append(c.loop.breakJumps, c.emitJump(OP_JUMP))
+	return nil, nil
+}
+
+func (c *Compiler) VisitContinueStmt(s *ast.ContinueStmt) (any, error) {
+	if err := c.leaveTries(c.loop.tries); err != nil {
+		return nil, err
+	}
+	c.token = s.Keyword
+	c.popLocals(c.loop.scopeDepth)
+	c.loop.continueJumps = append(c.loop.continueJumps, c.emitJump(OP_JUMP))
+	return nil, nil
+}
+
+func (c *Compiler) VisitFunctionStmt(s *ast.FunctionStmt) (any, error) {
+	c.token = s.Name
+	if err := c.declareVariable(s.Name); err != nil {
+		return nil, err
+	}
+	// A function may refer to itself, so it is usable before its body is
+	// compiled.
+	c.markInitialized()
+
+	if err := c.compileFunction(s.Name.Lexeme, s.Parameters, s.Body, FUNCTION); err != nil {
+		return nil, err
+	}
+	return nil, c.defineVariable(s.Name)
+}
+
+func (c *Compiler) VisitReturnStmt(s *ast.ReturnStmt) (any, error) {
+	c.token = s.Keyword
+	if s.Value == nil {
+		c.emitReturnValue()
+	} else if err := c.expr(s.Value); err != nil {
+		return nil, err
+	}
+
+	if c.tries != nil {
+		// The return value stays on the stack while finally clauses run.
+		if err := c.addHiddenLocal(); err != nil {
+			return nil, err
+		}
+		err := c.leaveTries(nil)
+		c.locals = c.locals[:len(c.locals)-1]
+		if err != nil {
+			return nil, err
+		}
+		c.token = s.Keyword
+	}
+	c.emitOp(OP_RETURN)
+	return nil, nil
+}
+
+func (c *Compiler) VisitThrowStmt(s *ast.ThrowStmt) (any, error) {
+	if err := c.expr(s.Value); err != nil {
+		return nil, err
+	}
+	c.token = s.Keyword
+	c.emitOp(OP_THROW)
+	return nil, nil
+}
+
+func (c *Compiler) VisitImportStmt(s *ast.ImportStmt) (any, error) {
+	return nil, CompileError{Token: s.Keyword, Message: "Modules are not supported by the vm backend; run with --backend=tree."}
+}
+
+// VisitExportStmt compiles the declaration alone, since a script run by the
+// vm can't be imported.
+func (c *Compiler) VisitExportStmt(s *ast.ExportStmt) (any, error) {
+	return nil, c.stmt(s.Declaration)
+}
+
+// VisitTryStmt installs an exception handler around the body, and around
+// the catch clause when there is a finally clause. The finally clause is
+// compiled once for every way of leaving the statement.
+func (c *Compiler) VisitTryStmt(s *ast.TryStmt) (any, error) {
+	c.token = s.Keyword
+	try := &tryCompiler{
+		enclosing:  c.tries,
+		finally:    s.Finally,
+		scopeDepth: c.scopeDepth,
+		loop:       c.loop,
+		handler:    true,
+	}
+
+	tryOp := OP_TRY
+	if s.Catch == nil {
+		tryOp = OP_TRY_FINALLY
+	}
+	handlerJump := c.emitJump(tryOp)
+	c.tries = try
+	err := c.stmt(s.Body)
+	c.tries = try.enclosing
+	if err != nil {
+		return nil, err
+	}
+	c.token = s.Keyword
+	c.emitOp(OP_POP_HANDLER)
+	if s.Finally != nil {
+		if err := c.stmt(s.Finally); err != nil {
+			return nil, err
+		}
+	}
+	endJumps := []int{c.emitJump(OP_JUMP)}
+
+	if err := c.patchJump(handlerJump); err != nil {
+		return nil, err
+	}
+
+	// The VM enters a handler with the exception pushed on the stack: the
+	// thrown value for OP_TRY, the pending error for OP_TRY_FINALLY.
+	hidden := 1
+	if s.Catch != nil {
+		c.beginScope()
+		c.token = s.CatchName
+		if err := c.addLocal(s.CatchName); err != nil {
+			return nil, err
+		}
+		c.markInitialized()
+
+		if s.Finally == nil {
+			if err := c.stmt(s.Catch); err != nil {
+				return nil, err
+			}
+			c.endScope()
+			return nil, c.patchJumps(endJumps)
+		}
+
+		catchJump := c.emitJump(OP_TRY_FINALLY)
+		c.tries = try
+		err := c.stmt(s.Catch)
+		c.tries = try.enclosing
+		if err != nil {
+			return nil, err
+		}
+		c.token = s.Keyword
+		c.emitOp(OP_POP_HANDLER)
+		c.endScope()
+		if err := c.stmt(s.Finally); err != nil {
+			return nil, err
+		}
+		endJumps = append(endJumps, c.emitJump(OP_JUMP))
+
+		// An exception from the catch clause lands above the catch
+		// variable's slot.
+		if err := c.patchJump(catchJump); err != nil {
+			return nil, err
+		}
+		c.beginScope()
+		if err := c.addHiddenLocal(); err != nil {
+			return nil, err
+		}
+		hidden++
+	} else {
+		c.beginScope()
+	}
+
+	// Run the finally clause, then rethrow.
+	if err := c.addHiddenLocal(); err != nil {
+		return nil, err
+	}
+	if err := c.stmt(s.Finally); err != nil {
+		return nil, err
+	}
+	c.token = s.Keyword
+	c.emitOpOperand(OP_GET_LOCAL, len(c.locals)-1)
+	c.emitOp(OP_RETHROW)
+	// Nothing falls through the rethrow, so the hidden slots are not popped.
+	c.scopeDepth--
+	c.locals = c.locals[:len(c.locals)-hidden]
+
+	return nil, c.patchJumps(endJumps)
+}
+
+func (c *Compiler) VisitClassStmt(s *ast.ClassStmt) (any, error) {
+	c.token = s.Name
+	nameConstant, err := c.identifierConstant(s.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.declareVariable(s.Name); err != nil {
+		return nil, err
+	}
+
+	c.emitOpOperand(OP_CLASS, nameConstant)
+	if err := c.defineVariable(s.Name); err != nil {
+		return nil, err
+	}
+
+	classCompiler := &classCompiler{enclosing: c.currentClass, name: s.Name.Lexeme}
+	c.currentClass = classCompiler
+	defer func() {
+		c.currentClass = classCompiler.enclosing
+	}()
+
+	if s.Superclass != nil {
+		if _, err := c.VisitVariableExpr(s.Superclass); err != nil {
+			return nil, err
+		}
+
+		c.beginScope()
+		if err := c.addLocal(token.Token{Type: token.SUPER, Lexeme: "super", Line: s.Name.Line, Column: s.Name.Column}); err != nil {
+			return nil, err
+		}
+		c.markInitialized()
+
+		if err := c.namedVariable(s.Name, false); err != nil {
+			return nil, err
+		}
+		c.token = s.Name
+		c.emitOp(OP_INHERIT)
+		classCompiler.hasSuperclass = true
+	}
+
+	if err := c.namedVariable(s.Name, false); err != nil {
+		return nil, err
+	}
+	for _, method := range s.Methods {
+		c.token = method.Name
+		methodConstant, err := c.identifierConstant(method.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		functionType := METHOD
+		if method.Name.Lexeme == "init" {
+			functionType = INITIALIZER
+		}
+		if err := c.compileFunction(method.Name.Lexeme, method.Parameters, method.Body, functionType); err != nil {
+			return nil, err
+		}
+		c.emitOpOperand(OP_METHOD, methodConstant)
+	}
+	c.emitOp(OP_POP)
+
+	if classCompiler.hasSuperclass {
+		c.endScope()
+	}
+
+	return nil, nil
+}
+
+func (c *Compiler) VisitLiteralExpr(e *ast.LiteralExpr) (any, error) {
+	switch e.Value {
+	case nil:
+		c.emitOp(OP_NIL)
+	case true:
+		c.emitOp(OP_TRUE)
+	case false:
+		c.emitOp(OP_FALSE)
+	default:
+		return nil, c.emitConstant(e.Value)
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitGroupingExpr(e *ast.GroupingExpr) (any, error) {
+	return nil, c.expr(e.Expr)
+}
+
+func (c *Compiler) VisitUnaryExpr(e *ast.UnaryExpr) (any, error) {
+	if err := c.expr(e.Right); err != nil {
+		return nil, err
+	}
+
+	c.token = e.Operator
+	switch e.Operator.Type {
+	case token.MINUS:
+		c.emitOp(OP_NEGATE)
+	case token.BANG:
+		c.emitOp(OP_NOT)
+	default:
+		return nil, CompileError{Token: e.Operator, Message: "unknown unary operator"}
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitBinaryExpr(e *ast.BinaryExpr) (any, error) {
+	if err := c.expr(e.Left); err != nil {
+		return nil, err
+	}
+	if err := c.expr(e.Right); err != nil {
+		return nil, err
+	}
+
+	c.token = e.Operator
+	switch e.Operator.Type {
+	case token.STAR:
+		c.emitOp(OP_MULTIPLY)
+	case token.SLASH:
+		c.emitOp(OP_DIVIDE)
+	case token.PLUS:
+		c.emitOp(OP_ADD)
+	case token.MINUS:
+		c.emitOp(OP_SUBTRACT)
+	case token.GREATER:
+		c.emitOp(OP_GREATER)
+	case token.GREATER_EQUAL:
+		c.emitOp(OP_GREATER_EQUAL)
+	case token.LESS:
+		c.emitOp(OP_LESS)
+	case token.LESS_EQUAL:
+		c.emitOp(OP_LESS_EQUAL)
+	case token.EQUAL_EQUAL:
+		c.emitOp(OP_EQUAL)
+	case token.BANG_EQUAL:
+		c.emitOp(OP_NOT_EQUAL)
+	default:
+		return nil, CompileError{Token: e.Operator, Message: "unknown binary operator"}
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitVariableExpr(e *ast.VariableExpr) (any, error) {
+	c.token = e.Name
+	return nil, c.namedVariable(e.Name, false)
+}
+
+func (c *Compiler) VisitAssignmentExpr(e *ast.AssignmentExpr) (any, error) {
+	if err := c.expr(e.Value); err != nil {
+		return nil, err
+	}
+	c.token = e.Name
+	return nil, c.namedVariable(e.Name, true)
+}
+
+func (c *Compiler) VisitLogicalExpr(e *ast.LogicalExpr) (any, error) {
+	if err := c.expr(e.Left); err != nil {
+		return nil, err
+	}
+
+	var endJump int
+	if e.Operator.Type == token.OR {
+		elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+		endJump = c.emitJump(OP_JUMP)
+		if err := c.patchJump(elseJump); err != nil {
+			return nil, err
+		}
+	} else {
+		endJump = c.emitJump(OP_JUMP_IF_FALSE)
+	}
+
+	c.emitOp(OP_POP)
+	if err := c.expr(e.Right); err != nil {
+		return nil, err
+	}
+	return nil, c.patchJump(endJump)
+}
+
+func (c *Compiler) VisitFunctionExpr(e *ast.FunctionExpr) (any, error) {
+	c.token = e.Keyword
+	return nil, c.compileFunction("anonymous", e.Parameters, e.Body, FUNCTION)
+}
+
+func (c *Compiler) VisitCallExpr(e *ast.CallExpr) (any, error) {
+	if err := c.expr(e.Callee); err != nil {
+		return nil, err
+	}
+	for _, arg := range e.Arguments {
+		if err := c.expr(arg); err != nil {
+			return nil, err
+		}
+	}
+
+	c.token = e.Paren
+	c.emitBytes(byte(OP_CALL), byte(len(e.Arguments)))
+	return nil, nil
+}
+
+func (c *Compiler) VisitGetExpr(e *ast.GetExpr) (any, error) {
+	if err := c.expr(e.Object); err != nil {
+		return nil, err
+	}
+
+	c.token = e.Name
+	name, err := c.identifierConstant(e.Name)
+	if err != nil {
+		return nil, err
+	}
+	c.emitOpOperand(OP_GET_PROPERTY, name)
+	return nil, nil
+}
+
+// VisitSetExpr checks the receiver is an instance before compiling the
+// value, so that a bad receiver is reported before the value's side effects
+// happen, as the tree-walking interpreter does.
+func (c *Compiler) VisitSetExpr(e *ast.SetExpr) (any, error) {
+	if err := c.expr(e.Object); err != nil {
+		return nil, err
+	}
+	c.token = e.Name
+	c.emitOp(OP_CHECK_INSTANCE)
+	if err := c.expr(e.Value); err != nil {
+		return nil, err
+	}
+
+	c.token = e.Name
+	name, err := c.identifierConstant(e.Name)
+	if err != nil {
+		return nil, err
+	}
+	c.emitOpOperand(OP_SET_PROPERTY, name)
+	return nil, nil
+}
+
+func (c *Compiler) VisitListExpr(e *ast.ListExpr) (any, error) {
+	for _, element := range e.Elements {
+		if err := c.expr(element); err != nil {
+			return nil, err
+		}
+	}
+
+	c.token = e.LeftBracket
+	if len(e.Elements) > maxElements {
+		return nil, CompileError{Token: e.LeftBracket, Message: "Too many elements in list literal."}
+	}
+	c.emitOpOperand(OP_BUILD_LIST, len(e.Elements))
+	return nil, nil
+}
+
+func (c *Compiler) VisitMapExpr(e *ast.MapExpr) (any, error) {
+	for i, key := range e.Keys {
+		if err := c.expr(key); err != nil {
+			return nil, err
+		}
+		if err := c.expr(e.Values[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	c.token = e.LeftBrace
+	if len(e.Keys) > maxElements {
+		return nil, CompileError{Token: e.LeftBrace, Message: "Too many entries in map literal."}
+	}
+	c.emitOpOperand(OP_BUILD_MAP, len(e.Keys))
+	return nil, nil
+}
+
+func (c *Compiler) VisitIndexExpr(e *ast.IndexExpr) (any, error) {
+	if err := c.expr(e.Object); err != nil {
+		return nil, err
+	}
+	if err := c.expr(e.Index); err != nil {
+		return nil, err
+	}
+
+	c.token = e.Bracket
+	c.emitOp(OP_GET_INDEX)
+	return nil, nil
+}
+
+func (c *Compiler) VisitIndexSetExpr(e *ast.IndexSetExpr) (any, error) {
+	if err := c.expr(e.Object); err != nil {
+		return nil, err
+	}
+	if err := c.expr(e.Index); err != nil {
+		return nil, err
+	}
+	if err := c.expr(e.Value); err != nil {
+		return nil, err
+	}
+
+	c.token = e.Bracket
+	c.emitOp(OP_SET_INDEX)
+	return nil, nil
+}
+
+func (c *Compiler) VisitThisExpr(e *ast.ThisExpr) (any, error) {
+	c.token = e.Keyword
+	return nil, c.namedVariable(e.Keyword, false)
+}
+
+func (c *Compiler) VisitSuperExpr(e *ast.SuperExpr) (any, error) {
+	c.token = e.Keyword
+	name, err := c.identifierConstant(e.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	thisToken := token.Token{Type: token.THIS, Lexeme: "this", Line: e.Keyword.Line, Column: e.Keyword.Column}
+	if err := c.namedVariable(thisToken, false); err != nil {
+		return nil, err
+	}
+	if err := c.namedVariable(e.Keyword, false); err != nil {
+		return nil, err
+	}
+
+	c.token = e.Keyword
+	c.emitOpOperand(OP_GET_SUPER, name)
+	return nil, nil
+}
+
+func (c *Compiler) compileFunction(name string, parameters []token.Token, body []ast.Stmt, functionType functionType) error {
+	fc := newCompiler(c, functionType, name)
+	fc.function.Arity = len(parameters)
+	if functionType == METHOD || functionType == INITIALIZER {
+		fc.function.ClassName = c.currentClass.name
+	}
+	fc.beginScope()
+
+	for _, param := range parameters {
+		if err := fc.declareVariable(param); err != nil {
+			return err
+		}
+		if err := fc.defineVariable(param); err != nil {
+			return err
+		}
+	}
+
+	for _, stmt := range body {
+		if err := fc.stmt(stmt); err != nil {
+			return err
+		}
+	}
+	fc.emitReturn()
+
+	fn := fc.function
+	fn.UpvalueCount = len(fc.upvalues)
+
+	index, err := c.makeConstant(fn)
+	if err != nil {
+		return err
+	}
+	c.emitOpOperand(OP_CLOSURE, index)
+	for _, uv := range fc.upvalues {
+		isLocal := byte(0)
+		if uv.isLocal {
+			isLocal = 1
+		}
+		c.emitBytes(isLocal)
+		c.emitOperand(uv.index)
+	}
+	return nil
+}
+
+func (c *Compiler) namedVariable(name token.Token, assign bool) error {
+	getOp, setOp := OP_GET_GLOBAL, OP_SET_GLOBAL
+	arg := c.resolveLocal(name)
+	if arg != -1 {
+		getOp, setOp = OP_GET_LOCAL, OP_SET_LOCAL
+	} else if arg = c.resolveUpvalue(name); arg != -1 {
+		getOp, setOp = OP_GET_UPVALUE, OP_SET_UPVALUE
+	} else {
+		index, err := c.identifierConstant(name)
+		if err != nil {
+			return err
+		}
+		op := getOp
+		if assign {
+			op = setOp
+		}
+		c.emitOpOperand(op, index)
+		return nil
+	}
+
+	if arg < 0 {
+		return CompileError{Token: name, Message: "Too many closure variables in function."}
+	}
+
+	op := getOp
+	if assign {
+		op = setOp
+	}
+	c.emitOpOperand(op, arg)
+	return nil
+}
+
+func (c *Compiler) resolveLocal(name token.Token) int {
+	for i := len(c.locals) - 1; i >= 0; i-- {
+		if c.locals[i].name == name.Lexeme {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveUpvalue returns -1 when the name is global and -2 when the function
+// has run out of upvalue slots.
+func (c *Compiler) resolveUpvalue(name token.Token) int {
+	if c.enclosing == nil {
+		return -1
+	}
+
+	if local := c.enclosing.resolveLocal(name); local != -1 {
+		c.enclosing.locals[local].isCaptured = true
+		return c.addUpvalue(local, true)
+	}
+
+	if upvalue := c.enclosing.resolveUpvalue(name); upvalue >= 0 {
+		return c.addUpvalue(upvalue, false)
+	} else {
+		return upvalue
+	}
+}
+
+func (c *Compiler) addUpvalue(index int, isLocal bool) int {
+	for i, uv := range c.upvalues {
+		if uv.index == index && uv.isLocal == isLocal {
+			return i
+		}
+	}
+
+	if len(c.upvalues) == maxUpvalues {
+		return -2
+	}
+
+	c.upvalues = append(c.upvalues, upvalue{index: index, isLocal: isLocal})
+	return len(c.upvalues) - 1
+}
+
+func (c *Compiler) declareVariable(name token.Token) error {
+	if c.scopeDepth == 0 {
+		return nil
+	}
+	return c.addLocal(name)
+}
+
+func (c *Compiler) addLocal(name token.Token) error {
+	if len(c.locals) == maxLocals {
+		return CompileError{Token: name, Message: "Too many local variables in function."}
+	}
+	c.locals = append(c.locals, local{name: name.Lexeme, depth: -1})
+	return nil
+}
+
+func (c *Compiler) defineVariable(name token.Token) error {
+	if c.scopeDepth > 0 {
+		c.markInitialized()
+		return nil
+	}
+
+	index, err := c.identifierConstant(name)
+	if err != nil {
+		return err
+	}
+	c.emitOpOperand(OP_DEFINE_GLOBAL, index)
+	return nil
+}
+
+// addHiddenLocal tracks a stack slot holding an unnamed value, such as a
+// caught exception, so that later locals get the right slots.
+func (c *Compiler) addHiddenLocal() error {
+	if len(c.locals) == maxLocals {
+		return CompileError{Token: c.token, Message: "Too many local variables in function."}
+	}
+	c.locals = append(c.locals, local{name: "", depth: c.scopeDepth})
+	return nil
+}
+
+// leaveTries emits what a jump out of the try statements inside outer
+// needs, innermost first: removing their exception handlers and running
+// their finally clauses.
+func (c *Compiler) leaveTries(outer *tryCompiler) error {
+	tries, loop := c.tries, c.loop
+	defer func() {
+		c.tries, c.loop = tries, loop
+	}()
+
+	for try := tries; try != outer; try = try.enclosing {
+		if try.handler {
+			c.emitOp(OP_POP_HANDLER)
+		}
+		if try.finally != nil {
+			c.tries, c.loop = try.enclosing, try.loop
+			if err := c.inlineFinally(try); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// inlineFinally compiles the finally clause of try at a jump out of it.
+// Locals declared inside the try statement are still on the stack there,
+// but hidden from the clause, which cannot see them in the source.
+func (c *Compiler) inlineFinally(try *tryCompiler) error {
+	var names []string
+	for i := len(c.locals) - 1; i >= 0 && c.locals[i].depth > try.scopeDepth; i-- {
+		names = append(names, c.locals[i].name)
+		c.locals[i].name = ""
+	}
+	err := c.stmt(try.finally)
+	for i, name := range names {
+		c.locals[len(c.locals)-1-i].name = name
+	}
+	return err
+}
+
+func (c *Compiler) markInitialized() {
+	if c.scopeDepth == 0 {
+		return
+	}
+	c.locals[len(c.locals)-1].depth = c.scopeDepth
+}
+
+func (c *Compiler) beginScope() {
+	c.scopeDepth++
+}
+
+func (c *Compiler) endScope() {
+	c.scopeDepth--
+
+	c.popLocals(c.scopeDepth)
+	for len(c.locals) > 0 && c.locals[len(c.locals)-1].depth > c.scopeDepth {
+		c.locals = c.locals[:len(c.locals)-1]
+	}
+}
+
+// popLocals emits code discarding the locals declared deeper than depth.
+// The compiler keeps tracking them, since break and continue leave scopes
+// only at runtime.
+func (c *Compiler) popLocals(depth int) {
+	for i := len(c.locals) - 1; i >= 0 && c.locals[i].depth > depth; i-- {
+		if c.locals[i].isCaptured {
+			c.emitOp(OP_CLOSE_UPVALUE)
+		} else {
+			c.emitOp(OP_POP)
+		}
+	}
+}
+
+func (c *Compiler) identifierConstant(name token.Token) (int, error) {
+	return c.makeConstantFor(name, name.Lexeme)
+}
+
+func (c *Compiler) makeConstant(value any) (int, error) {
+	return c.makeConstantFor(c.token, value)
+}
+
+func (c *Compiler) makeConstantFor(at token.Token, value any) (int, error) {
+	// Names and literals are interned so repeated references share a slot.
+	index, ok := c.constants[value]
+	switch value.(type) {
+	case string, float64:
+		if !ok {
+			index = c.chunk().addConstant(value)
+			c.constants[value] = index
+		}
+	default:
+		index = c.chunk().addConstant(value)
+	}
+	if index >= maxConstants {
+		return 0, CompileError{Token: at, Message: "Too many constants in one chunk."}
+	}
+	return index, nil
+}
+
+func (c *Compiler) emitConstant(value any) error {
+	index, err := c.makeConstant(value)
+	if err != nil {
+		return err
+	}
+	c.emitOpOperand(OP_CONSTANT, index)
+	return nil
+}
+
+func (c *Compiler) emitReturn() {
+	c.emitReturnValue()
+	c.emitOp(OP_RETURN)
+}
+
+// emitReturnValue pushes what a bare return statement returns.
+func (c *Compiler) emitReturnValue() {
+	if c.functionType == INITIALIZER {
+		c.emitOpOperand(OP_GET_LOCAL, 0)
+	} else {
+		c.emitOp(OP_NIL)
+	}
+}
+
+func (c *Compiler) emitJump(op OpCode) int {
+	c.emitOpOperand(op, MAX_OPERAND)
+	return len(c.chunk().Code) - OPERAND_SIZE
+}
+
+func (c *Compiler) patchJumps(offsets []int) error {
+	for _, offset := range offsets {
+		if err := c.patchJump(offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) patchJump(offset int) error {
+	jump := len(c.chunk().Code) - offset - OPERAND_SIZE
+	if jump > maxJump {
+		return CompileError{Token: c.token, Message: "Too much code to jump over."}
+	}
+
+	putOperand(c.chunk().Code[offset:], jump)
+	return nil
+}
+
+func (c *Compiler) emitLoop(loopStart int) error {
+	c.emitOp(OP_LOOP)
+
+	offset := len(c.chunk().Code) - loopStart + OPERAND_SIZE
+	if offset > maxJump {
+		return CompileError{Token: c.token, Message: "Loop body too large."}
+	}
+	c.emitOperand(offset)
+	return nil
+}
+
+func (c *Compiler) emitOp(op OpCode) {
+	c.chunk().write(byte(op), c.token.Span())
+}
+
+func (c *Compiler) emitOpOperand(op OpCode, operand int) {
+	c.emitOp(op)
+	c.emitOperand(operand)
+}
+
+func (c *Compiler) emitOperand(operand int) {
+	var bytes [OPERAND_SIZE]byte
+	putOperand(bytes[:], operand)
+	c.emitBytes(bytes[:]...)
+}
+
+func putOperand(code []byte, operand int) {
+	code[0] = byte(operand >> 16)
+	code[1] = byte(operand >> 8)
+	code[2] = byte(operand)
+}
+
+func (c *Compiler) emitBytes(bytes ...byte) {
+	for _, b := range bytes {
+		c.chunk().write(b, c.token.Span())
+	}
+}
+
+func (c *Compiler) chunk() *Chunk {
+	return &c.function.Chunk
+}
+
+func (c *Compiler) stmt(stmt ast.Stmt) error {
+	_, err := stmt.Accept(c)
+	return err
+}
+
+func (c *Compiler) expr(expr ast.Expr) error {
+	_, err := expr.Accept(c)
+	return err
+}
@@ -0,0 +1,122 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+func compile(t *testing.T, source string) (*Function, error) {
+	t.Helper()
+
+	sc := scanner.NewScanner(source)
+	tokens, err := sc.ScanTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, parseErrors := parser.NewParser(tokens).Parse()
+	if len(parseErrors) > 0 {
+		t.Fatal(parseErrors[0])
+	}
+	return Compile(statements)
+}
+
+func TestDisassemble(t *testing.T) {
+	source := `var a = 1;
+fun f(b) {
+  if (b) return a;
+  return b;
+}
+print f(a);`
+	want := `== <script> ==
+0000    1 OP_CONSTANT         0 '1'
+0004    | OP_DEFINE_GLOBAL    1 'a'
+0008    2 OP_CLOSURE          2 <fn f>
+0012    | OP_DEFINE_GLOBAL    3 'f'
+0016    6 OP_GET_GLOBAL       3 'f'
+0020    | OP_GET_GLOBAL       1 'a'
+0024    | OP_CALL             1
+0026    | OP_PRINT
+0027    | OP_NIL
+0028    | OP_RETURN
+
+== <fn f> ==
+0000    3 OP_GET_LOCAL        1
+0004    | OP_JUMP_IF_FALSE    4 -> 18
+0008    | OP_POP
+0009    | OP_GET_GLOBAL       0 'a'
+0013    | OP_RETURN
+0014    | OP_JUMP            14 -> 19
+0018    | OP_POP
+0019    4 OP_GET_LOCAL        1
+0023    | OP_RETURN
+0024    | OP_NIL
+0025    | OP_RETURN
+`
+
+	fn, err := compile(t, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	Disassemble(&b, fn)
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+// TestCompileLimits checks that programs the tree-walking interpreter runs
+// don't outgrow the operands of the vm's instructions.
+func TestCompileLimits(t *testing.T) {
+	var locals, upvalues, body, constants strings.Builder
+	for i := range 300 {
+		fmt.Fprintf(&locals, "var v%d = %d;\n", i, i)
+		fmt.Fprintf(&upvalues, "v%d + ", i)
+	}
+	for range 12000 {
+		body.WriteString("x = x + 1;\n")
+	}
+	for i := range 33000 {
+		fmt.Fprintf(&constants, "var g%d = %d;\n", i, i)
+	}
+
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{name: "300 locals", source: "{\n" + locals.String() + "print v299;\n}"},
+		{name: "300 upvalues", source: "{\n" + locals.String() + "fun f() { return " + upvalues.String() + "0; }\n}"},
+		{name: "long jump", source: "var x = 0;\nif (x == 0) {\n" + body.String() + "} else {\n" + body.String() + "}"},
+		{name: "long loop", source: "var x = 0;\nwhile (x < 1) {\n" + body.String() + "}"},
+		{name: "33000 globals", source: constants.String()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := compile(t, test.source); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{source: `import "lib.lox" as lib;`, want: "[line 1] Error at 'import': Modules are not supported by the vm backend; run with --backend=tree."},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			_, err := compile(t, test.source)
+			if err == nil || err.Error() != test.want {
+				t.Errorf("got %v, want %s", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+)
+
+// Disassemble writes a human-readable listing of fn and every function
+// nested in its constant pool.
+func Disassemble(w io.Writer, fn *Function) {
+	fmt.Fprintf(w, "== %s ==\n", fn)
+	chunk := &fn.Chunk
+	for offset := 0; offset < len(chunk.Code); {
+		offset = disassembleInstruction(w, chunk, offset)
+	}
+
+	for _, constant := range chunk.Constants {
+		if nested, ok := constant.(*Function); ok {
+			fmt.Fprintln(w)
+			Disassemble(w, nested)
+		}
+	}
+}
+
+func disassembleInstruction(w io.Writer, chunk *Chunk, offset int) int {
+	fmt.Fprintf(w, "%04d ", offset)
+	if offset > 0 && chunk.Spans[offset].Line == chunk.Spans[offset-1].Line {
+		fmt.Fprint(w, "   | ")
+	} else {
+		fmt.Fprintf(w, "%4d ", chunk.Spans[offset].Line)
+	}
+
+	op := OpCode(chunk.Code[offset])
+	switch op {
+	case OP_CONSTANT, OP_GET_GLOBAL, OP_DEFINE_GLOBAL, OP_SET_GLOBAL,
+		OP_GET_PROPERTY, OP_SET_PROPERTY, OP_GET_SUPER, OP_CLASS, OP_METHOD:
+		index := ReadOperand(chunk.Code, offset+1)
+		fmt.Fprintf(w, "%-16s %4d '%v'\n", op, index, chunk.Constants[index])
+		return offset + 1 + OPERAND_SIZE
+	case OP_GET_LOCAL, OP_SET_LOCAL, OP_GET_UPVALUE, OP_SET_UPVALUE, OP_BUILD_LIST, OP_BUILD_MAP:
+		fmt.Fprintf(w, "%-16s %4d\n", op, ReadOperand(chunk.Code, offset+1))
+		return offset + 1 + OPERAND_SIZE
+	case OP_CALL:
+		fmt.Fprintf(w, "%-16s %4d\n", op, chunk.Code[offset+1])
+		return offset + 2
+	case OP_JUMP, OP_JUMP_IF_FALSE, OP_TRY, OP_TRY_FINALLY:
+		next := offset + 1 + OPERAND_SIZE
+		fmt.Fprintf(w, "%-16s %4d -> %d\n", op, offset, next+ReadOperand(chunk.Code, offset+1))
+		return next
+	case OP_LOOP:
+		next := offset + 1 + OPERAND_SIZE
+		fmt.Fprintf(w, "%-16s %4d -> %d\n", op, offset, next-ReadOperand(chunk.Code, offset+1))
+		return next
+	case OP_CLOSURE:
+		index := ReadOperand(chunk.Code, offset+1)
+		fn := chunk.Constants[index].(*Function)
+		fmt.Fprintf(w, "%-16s %4d %v\n", op, index, fn)
+		offset += 1 + OPERAND_SIZE
+		for range fn.UpvalueCount {
+			kind := "upvalue"
+			if chunk.Code[offset] == 1 {
+				kind = "local"
+			}
+			fmt.Fprintf(w, "%04d    |                     %s %d\n", offset, kind, ReadOperand(chunk.Code, offset+1))
+			offset += 1 + OPERAND_SIZE
+		}
+		return offset
+	default:
+		fmt.Fprintf(w, "%s\n", op)
+		return offset + 1
+	}
+}
@@ -0,0 +1,152 @@
+package diagnostics
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiBlue   = "\x1b[34m"
+)
+
+type ColorMode string
+
+const (
+	COLOR_AUTO   ColorMode = "auto"
+	COLOR_ALWAYS ColorMode = "always"
+	COLOR_NEVER  ColorMode = "never"
+)
+
+func ParseColorMode(s string) (ColorMode, error) {
+	switch mode := ColorMode(s); mode {
+	case COLOR_AUTO, COLOR_ALWAYS, COLOR_NEVER:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid color mode %q: want auto, always or never", s)
+	}
+}
+
+// Spanned is implemented by errors that know which part of the source they
+// refer to.
+type Spanned interface {
+	Span() token.Span
+}
+
+// Hinted is implemented by errors that can suggest a fix.
+type Hinted interface {
+	Hint() string
+}
+
+// Traced is implemented by errors that can show the calls that led to them.
+type Traced interface {
+	Traceback() string
+}
+
+type Renderer struct {
+	out    io.Writer
+	source string
+	color  bool
+}
+
+// NewRenderer returns a Renderer writing to out. In COLOR_AUTO mode color is
+// used only when out is a terminal and NO_COLOR is unset.
+func NewRenderer(out io.Writer, source string, mode ColorMode) *Renderer {
+	color := mode == COLOR_ALWAYS
+	if mode == COLOR_AUTO {
+		color = isTerminal(out) && os.Getenv("NO_COLOR") == ""
+	}
+
+	return &Renderer{
+		out:    out,
+		source: source,
+		color:  color,
+	}
+}
+
+// Report prints err followed by the source line it points at, with the
+// offending span underlined, the error's hint if it has one, and its
+// traceback.
+func (r *Renderer) Report(err error) {
+	lines := strings.Split(err.Error(), "\n")
+	fmt.Fprintln(r.out, r.paint(ansiBold+ansiRed, lines[0]))
+	for _, line := range lines[1:] {
+		fmt.Fprintln(r.out, line)
+	}
+
+	if spanned, ok := err.(Spanned); ok {
+		r.snippet(spanned.Span())
+	}
+
+	if hinted, ok := err.(Hinted); ok {
+		if hint := hinted.Hint(); hint != "" {
+			fmt.Fprintf(r.out, "%s %s\n", r.paint(ansiYellow, "  hint:"), hint)
+		}
+	}
+
+	if traced, ok := err.(Traced); ok {
+		fmt.Fprint(r.out, traced.Traceback())
+	}
+}
+
+func (r *Renderer) snippet(span token.Span) {
+	if span.IsZero() || span.Start > len(r.source) {
+		return
+	}
+
+	lineStart := strings.LastIndexByte(r.source[:span.Start], '\n') + 1
+	lineEnd := len(r.source)
+	if i := strings.IndexByte(r.source[span.Start:], '\n'); i >= 0 {
+		lineEnd = span.Start + i
+	}
+	text := strings.TrimRight(r.source[lineStart:lineEnd], "\r")
+
+	end := min(max(span.End, span.Start+1), lineEnd)
+	width := max(utf8.RuneCountInString(r.source[span.Start:end]), 1)
+
+	// Keep tabs so the underline stays aligned with the source line.
+	var pad strings.Builder
+	for _, c := range r.source[lineStart:span.Start] {
+		if c == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+
+	gutter := fmt.Sprintf("%d", span.Line)
+	blank := strings.Repeat(" ", len(gutter))
+	underline := "^" + strings.Repeat("~", width-1)
+
+	fmt.Fprintf(r.out, "%s %s\n", r.paint(ansiBlue, blank), r.paint(ansiBlue, "|"))
+	fmt.Fprintf(r.out, "%s %s %s\n", r.paint(ansiBlue, gutter), r.paint(ansiBlue, "|"), text)
+	fmt.Fprintf(r.out, "%s %s %s%s\n", r.paint(ansiBlue, blank), r.paint(ansiBlue, "|"), pad.String(), r.paint(ansiRed, underline))
+}
+
+func (r *Renderer) paint(code, text string) string {
+	if !r.color {
+		return text
+	}
+	return code + text + ansiReset
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
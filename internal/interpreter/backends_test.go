@@ -0,0 +1,73 @@
+package interpreter_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/compiler"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/interpreter"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/vm"
+)
+
+// runVM executes source the way run --backend=vm does and returns its
+// stdout, its stderr without source snippets, and its exit code.
+func runVM(source string) (string, string, int) {
+	var stdout, stderr strings.Builder
+
+	sc := scanner.NewScanner(source)
+	tokens, err := sc.ScanTokens()
+	if err != nil {
+		fmt.Fprintln(&stderr, err)
+		return stdout.String(), stderr.String(), 65
+	}
+
+	statements, parseErrors := parser.NewParser(tokens).Parse()
+	if len(parseErrors) > 0 {
+		for _, err := range parseErrors {
+			fmt.Fprintln(&stderr, err)
+		}
+		return stdout.String(), stderr.String(), 65
+	}
+
+	resolver := interpreter.NewResolver(interpreter.NewInterpreter())
+	if _, err := resolver.Resolve(statements); err != nil {
+		fmt.Fprintln(&stderr, err)
+		return stdout.String(), stderr.String(), 65
+	}
+	script, err := compiler.Compile(statements)
+	if err != nil {
+		fmt.Fprintln(&stderr, err)
+		return stdout.String(), stderr.String(), 65
+	}
+
+	machine := vm.NewVM()
+	machine.SetStdout(&stdout)
+	if err := machine.Interpret(script); err != nil {
+		fmt.Fprintln(&stderr, err)
+		return stdout.String(), stderr.String(), 70
+	}
+	return stdout.String(), stderr.String(), 0
+}
+
+// TestBackendsAgree runs the runtime error programs on both backends,
+// which must print the same output and exit the same way.
+func TestBackendsAgree(t *testing.T) {
+	for _, test := range interpreter.RuntimeErrorSources() {
+		t.Run(test.Name, func(t *testing.T) {
+			treeStdout, treeStderr, treeCode := interpreter.Run(test.Source)
+			stdout, stderr, code := runVM(test.Source)
+			if stdout != treeStdout {
+				t.Errorf("vm stdout = %q, tree stdout = %q", stdout, treeStdout)
+			}
+			if stderr != treeStderr {
+				t.Errorf("vm stderr = %q, tree stderr = %q", stderr, treeStderr)
+			}
+			if code != treeCode {
+				t.Errorf("vm exit code = %d, tree exit code = %d", code, treeCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package interpreter
+
+import (
+	"io"
+	"testing"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+const fibSource = `
+fun fib(n) {
+  if (n < 2) return n;
+  return fib(n - 1) + fib(n - 2);
+}
+print fib(20);
+`
+
+// compile parses and resolves source for a fresh interpreter that discards
+// its output.
+func compile(b *testing.B, source string) (Interpreter, []ast.Stmt) {
+	b.Helper()
+
+	sc := scanner.NewScanner(source)
+	tokens, err := sc.ScanTokens()
+	if err != nil {
+		b.Fatal(err)
+	}
+	statements, parseErrors := parser.NewParser(tokens).Parse()
+	if len(parseErrors) > 0 {
+		b.Fatal(parseErrors[0])
+	}
+
+	interpreter := NewInterpreter()
+	interpreter.SetStdout(io.Discard)
+	resolver := NewResolver(interpreter)
+	if _, err := resolver.Resolve(statements); err != nil {
+		b.Fatal(err)
+	}
+	return interpreter, statements
+}
+
+// Returning through many frames at once was the slow path when returns
+// unwound by panicking.
+const deepRecursionSource = `
+fun count(n) {
+  if (n == 0) return 0;
+  return 1 + count(n - 1);
+}
+print count(1000);
+`
+
+func benchmarkSource(b *testing.B, source string) {
+	interpreter, statements := compile(b, source)
+	b.ResetTimer()
+
+	for range b.N {
+		for _, stmt := range statements {
+			if _, err := stmt.Accept(&interpreter); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	benchmarkSource(b, fibSource)
+}
+
+func BenchmarkDeepRecursion(b *testing.B) {
+	benchmarkSource(b, deepRecursionSource)
+}
+
+const loopSource = `
+{
+  var sum = 0;
+  for (var i = 0; i < 100000; i = i + 1) {
+    sum = sum + i;
+  }
+  print sum;
+}
+`
+
+const closureSource = `
+fun makeCounter() {
+  var count = 0;
+  fun increment() {
+    count = count + 1;
+    return count;
+  }
+  return increment;
+}
+
+{
+  var total = 0;
+  for (var i = 0; i < 10000; i = i + 1) {
+    var counter = makeCounter();
+    counter();
+    total = total + counter();
+  }
+  print total;
+}
+`
+
+func BenchmarkLoop(b *testing.B) {
+	benchmarkSource(b, loopSource)
+}
+
+func BenchmarkClosures(b *testing.B) {
+	benchmarkSource(b, closureSource)
+}
@@ -0,0 +1,115 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
+)
+
+// ErrStepLimit is the cause of a BudgetError raised when a program uses up
+// its step budget.
+var ErrStepLimit = errors.New("step limit exceeded")
+
+// BudgetError aborts a program that ran out of steps or whose context was
+// cancelled. Unlike a RuntimeError it can't be caught, and finally clauses
+// don't run while it unwinds.
+type BudgetError struct {
+	Message string
+	Line    int
+	Source  token.Span
+	// Cause is ErrStepLimit or the context's error.
+	Cause error
+}
+
+// NewBudgetError reports cause at source, the loop or call where the
+// budget ran out.
+func NewBudgetError(source token.Span, cause error) BudgetError {
+	message := "Step limit exceeded."
+	switch {
+	case errors.Is(cause, context.DeadlineExceeded):
+		message = "Execution timed out."
+	case errors.Is(cause, context.Canceled):
+		message = "Execution cancelled."
+	}
+	return BudgetError{Message: message, Line: source.Line, Source: source, Cause: cause}
+}
+
+func (e BudgetError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s\n[line %d]", e.Message, e.Line)
+}
+
+func (e BudgetError) Span() token.Span {
+	return e.Source
+}
+
+func (e BudgetError) Unwrap() error {
+	return e.Cause
+}
+
+// contextCheckInterval is how many steps pass between checks of the
+// context, which are slower than counting.
+const contextCheckInterval = 1024
+
+// Budget limits how long a program runs, by counting the steps it takes and
+// watching a context. Both backends count the same steps: each time a loop
+// goes back to its condition, and each call to a function or class. Other
+// statements and calls to natives aren't counted, so only the context
+// bounds the time they take; natives that wait for input give up once it
+// is done.
+type Budget struct {
+	ctx      context.Context
+	maxSteps int
+	steps    int
+	// last is where the most recent located step was taken.
+	last token.Span
+}
+
+func NewBudget() *Budget {
+	return &Budget{ctx: context.Background()}
+}
+
+// SetContext makes the budget run out once ctx is done.
+func (b *Budget) SetContext(ctx context.Context) {
+	b.ctx = ctx
+}
+
+// Context returns the context the budget watches.
+func (b *Budget) Context() context.Context {
+	if b == nil {
+		return context.Background()
+	}
+	return b.ctx
+}
+
+// SetMaxSteps limits how many more steps may be taken. Zero means no limit.
+func (b *Budget) SetMaxSteps(steps int) {
+	b.maxSteps = steps
+	b.steps = 0
+}
+
+// Spend counts a step taken at source, or at the previous step's source if
+// source is zero, and returns a BudgetError once the budget is used up.
+func (b *Budget) Spend(source token.Span) error {
+	if b == nil {
+		return nil
+	}
+	if !source.IsZero() {
+		b.last = source
+	}
+
+	b.steps++
+	if b.maxSteps > 0 && b.steps > b.maxSteps {
+		return NewBudgetError(b.last, ErrStepLimit)
+	}
+	if b.steps%contextCheckInterval == 0 || b.steps == 1 {
+		if err := b.ctx.Err(); err != nil {
+			return NewBudgetError(b.last, err)
+		}
+	}
+	return nil
+}
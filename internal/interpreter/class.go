@@ -19,6 +19,9 @@ func (cls class) String() string {
 }
 
 func (cls class) Call(interpreter Interpreter, arguments []any) (result any, err error) {
+	if err := interpreter.quota.Allocate(interpreter.stack.site(), instanceSize); err != nil {
+		return nil, err
+	}
 	instance := newInstance(cls)
 	if initMethod := cls.findMethod("init"); initMethod != nil {
 		return initMethod.bind(instance).Call(interpreter, arguments)
@@ -6,24 +6,27 @@ import (
 	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
 )
 
+// Environment holds the variables of one scope. Globals are looked up by
+// name in values. Local scopes leave values nil and keep their variables in
+// slots, at the indexes the resolver assigned in declaration order.
 type Environment struct {
 	values    map[string]any
+	slots     []any
 	enclosing *Environment
 }
 
-func newEnvironment(enclosing *Environment) Environment {
+// newEnvironment returns a local scope inside enclosing, or the global
+// scope if enclosing is nil.
+func newEnvironment(enclosing *Environment) *Environment {
 	if enclosing == nil {
-		return Environment{
-			enclosing: nil,
-			values:    make(map[string]any, 0),
-		}
+		return &Environment{values: make(map[string]any)}
 	}
+	return &Environment{enclosing: enclosing}
+}
 
-	enclosingCopy := *enclosing
-	return Environment{
-		enclosing: &enclosingCopy,
-		values:    make(map[string]any, 0),
-	}
+// newGlobals returns a global scope whose names shadow those of builtins.
+func newGlobals(builtins *Environment) *Environment {
+	return &Environment{values: make(map[string]any), enclosing: builtins}
 }
 
 func (e *Environment) get(name token.Token) (any, error) {
@@ -35,7 +38,7 @@ func (e *Environment) get(name token.Token) (any, error) {
 		return e.enclosing.get(name)
 	}
 
-	return nil, fmt.Errorf("undefined variable %s", name.Lexeme)
+	return nil, newRuntimeError(name, fmt.Sprintf("undefined variable %s", name.Lexeme))
 }
 
 func (e *Environment) assign(name token.Token, value any) (any, error) {
@@ -48,22 +51,25 @@ func (e *Environment) assign(name token.Token, value any) (any, error) {
 		return e.enclosing.assign(name, value)
 	}
 
-	return nil, fmt.Errorf("undefined variable %s", name.Lexeme)
+	return nil, newRuntimeError(name, fmt.Sprintf("undefined variable %s", name.Lexeme))
 }
 
+// define declares the next variable of the scope. Local variables must be
+// defined in the order the resolver declared them.
 func (e *Environment) define(name string, value any) {
-	e.values[name] = value
+	if e.values != nil {
+		e.values[name] = value
+		return
+	}
+	e.slots = append(e.slots, value)
 }
 
-func (e *Environment) getAt(distance int, name string) (any, error) {
-	env := e.ancestor(distance)
-	return env.values[name], nil
+func (e *Environment) getAt(distance, slot int) any {
+	return e.ancestor(distance).slots[slot]
 }
 
-func (e *Environment) assignAt(distance int, name token.Token, value any) error {
-	env := e.ancestor(distance)
-	env.values[name.Lexeme] = value
-	return nil
+func (e *Environment) assignAt(distance, slot int, value any) {
+	e.ancestor(distance).slots[slot] = value
 }
 
 func (e *Environment) ancestor(distance int) *Environment {
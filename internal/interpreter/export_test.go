@@ -0,0 +1,13 @@
+package interpreter
+
+// Run and RuntimeErrorSources let backends_test.go, which imports the vm,
+// run the same programs on both backends.
+var Run = run
+
+func RuntimeErrorSources() []struct{ Name, Source string } {
+	sources := make([]struct{ Name, Source string }, len(runtimeErrorTests))
+	for i, test := range runtimeErrorTests {
+		sources[i].Name, sources[i].Source = test.name, test.source
+	}
+	return sources
+}
@@ -8,56 +8,76 @@ import (
 
 type LoxFunction struct {
 	declaration   ast.FunctionStmt
-	closure       Environment
+	closure       *Environment
 	isInitializer bool
+	className     string
+	// module is where the function was declared. Its globals are the
+	// globals of the function body.
+	module *module
 }
 
-func newLoxFunction(declaration ast.FunctionStmt, closure Environment, isInitializer bool) *LoxFunction {
+func newLoxFunction(declaration ast.FunctionStmt, closure *Environment, isInitializer bool, module *module) *LoxFunction {
 	return &LoxFunction{
 		declaration:   declaration,
 		closure:       closure,
 		isInitializer: isInitializer,
+		module:        module,
 	}
 }
 
-type LoxFunctionReturnValue struct {
-	Value any
-}
-
-func (lf *LoxFunction) Call(interpreter Interpreter, arguments []any) (result any, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			if returnVal, ok := r.(LoxFunctionReturnValue); ok {
-				result = returnVal.Value
-				err = nil
-			} else {
-				panic(r)
-			}
-		}
-		if lf.isInitializer {
-			result, err = lf.closure.getAt(0, "this")
-		}
-	}()
-
-	environment := newEnvironment(&lf.closure)
+func (lf *LoxFunction) Call(interpreter Interpreter, arguments []any) (any, error) {
+	if err := interpreter.quota.Allocate(interpreter.stack.site(), environmentSize+valueSize*len(arguments)); err != nil {
+		return nil, err
+	}
+	environment := newEnvironment(lf.closure)
+	if lf.module != nil {
+		interpreter.globals = lf.module.globals
+		interpreter.module = lf.module
+	}
 
 	for i, param := range lf.declaration.Parameters {
 		environment.define(param.Lexeme, arguments[i])
 	}
 
-	return nil, interpreter.executeBlock(lf.declaration.Body, environment)
+	if err := interpreter.stack.push(lf.name(), lf.className); err != nil {
+		return nil, err
+	}
+	result, err := interpreter.executeBlock(lf.declaration.Body, environment)
+	if err != nil {
+		err = interpreter.stack.annotate(err, lf.module.file())
+	}
+	interpreter.stack.pop()
+	if err != nil {
+		return nil, err
+	}
+	if lf.isInitializer {
+		return lf.closure.getAt(0, 0), nil
+	}
+	if c, ok := result.(*completion); ok && c.kind == RETURN {
+		return c.value, nil
+	}
+	return nil, nil
 }
 
 func (lf *LoxFunction) bind(instance instance) *LoxFunction {
-	env := newEnvironment(&lf.closure)
+	env := newEnvironment(lf.closure)
 	env.define("this", instance)
-	return newLoxFunction(lf.declaration, env, lf.isInitializer)
+	bound := newLoxFunction(lf.declaration, env, lf.isInitializer, lf.module)
+	bound.className = lf.className
+	return bound
 }
 
 func (lf *LoxFunction) Arity() int {
 	return len(lf.declaration.Parameters)
 }
 
+func (lf *LoxFunction) name() string {
+	if lf.declaration.Name.Lexeme == "" {
+		return "anonymous"
+	}
+	return lf.declaration.Name.Lexeme
+}
+
 func (lf *LoxFunction) String() string {
-	return fmt.Sprintf("<fn %s>", lf.declaration.Name.Lexeme)
+	return fmt.Sprintf("<fn %s>", lf.name())
 }
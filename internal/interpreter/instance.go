@@ -18,6 +18,10 @@ func newInstance(class class) instance {
 	}
 }
 
+func (inst instance) Fields() map[string]any {
+	return inst.fields
+}
+
 func (inst instance) get(name token.Token) (any, error) {
 	if val, ok := inst.fields[name.Lexeme]; ok {
 		return val, nil
@@ -26,7 +30,7 @@ func (inst instance) get(name token.Token) (any, error) {
 		return method.bind(inst), nil
 	}
 
-	return nil, RuntimeError{Message: fmt.Sprintf("undefined property %s", name.Lexeme), Line: name.Line}
+	return nil, newRuntimeError(name, fmt.Sprintf("undefined property %s", name.Lexeme))
 }
 
 func (inst instance) set(name token.Token, value any) {
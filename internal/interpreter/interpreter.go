@@ -1,7 +1,12 @@
 package interpreter
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"reflect"
 
 	"github.com/codecrafters-io/interpreter-starter-go/internal/ast"
 	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
@@ -11,44 +16,162 @@ import (
 type RuntimeError struct {
 	Message string
 	Line    int
+	Source  token.Span
+	// Thrown is set for errors raised by a throw statement, and Value holds
+	// the thrown value. Catch clauses see other runtime errors as instances
+	// of the prelude's Error class.
+	Thrown bool
+	Value  any
+	// Trace holds the Lox calls active when the error was raised, outermost
+	// first.
+	Trace []Frame
+	// File is set for errors raised in an imported module, to the path of
+	// that module.
+	File string
+}
+
+func newRuntimeError(t token.Token, message string) RuntimeError {
+	return RuntimeError{Message: message, Line: t.Line, Source: t.Span()}
 }
 
 func (e RuntimeError) Error() string {
-	return fmt.Sprintf("%s \n[line %d]\n", e.Message, e.Line)
+	if e.File != "" {
+		return fmt.Sprintf("%s\n[line %d in %s]", e.Message, e.Line, e.File)
+	}
+	return fmt.Sprintf("%s\n[line %d]", e.Message, e.Line)
+}
+
+// Span is zero for errors in imported modules, since it points into a
+// different source than the script's.
+func (e RuntimeError) Span() token.Span {
+	if e.File != "" {
+		return token.Span{}
+	}
+	return e.Source
 }
 
 type Interpreter struct {
-	environment Environment
-	globals     Environment
-	locals      map[ast.Expr]int
+	environment *Environment
+	globals     *Environment
+	// builtins holds the natives and the prelude, and encloses the globals
+	// of every module.
+	builtins   *Environment
+	module     *module
+	modules    *modules
+	locals     map[ast.Expr]local
+	stdout     io.Writer
+	errorClass class
+	stack      *callStack
+	budget     *Budget
+	quota      *Quota
 }
 
 func NewInterpreter() Interpreter {
-	globals := newEnvironment(nil)
-	globals.define("clock", &ClockFunction{})
-	return Interpreter{
-		environment: globals,
-		globals:     globals,
-		locals:      make(map[ast.Expr]int, 0),
+	builtins := newEnvironment(nil)
+	interpreter := Interpreter{
+		environment: builtins,
+		globals:     builtins,
+		builtins:    builtins,
+		modules:     newModules(),
+		locals:      make(map[ast.Expr]local, 0),
+		stdout:      os.Stdout,
+		stack:       &callStack{maxDepth: DEFAULT_MAX_DEPTH},
+		budget:      NewBudget(),
+		quota:       NewQuota(),
 	}
+	interpreter.Install(Builtins())
+	interpreter.runPrelude()
+
+	interpreter.module = &module{script: true, globals: newGlobals(builtins), exports: make(map[string]bool)}
+	interpreter.environment = interpreter.module.globals
+	interpreter.globals = interpreter.module.globals
+	return interpreter
+}
+
+// Install defines every native in registry as a builtin, visible in every
+// module.
+func (i *Interpreter) Install(registry *NativeRegistry) {
+	for _, native := range registry.Natives() {
+		i.builtins.define(native.Name(), native)
+	}
+	for _, ns := range registry.Namespaces() {
+		i.builtins.define(ns.Name(), ns)
+	}
+}
+
+// SetStdout redirects the output of print statements.
+func (i *Interpreter) SetStdout(w io.Writer) {
+	i.stdout = w
+}
+
+// SetMaxDepth sets how many Lox calls may be active at once. It defaults
+// to DEFAULT_MAX_DEPTH, and depths above MAX_DEPTH are lowered to it.
+func (i *Interpreter) SetMaxDepth(depth int) {
+	i.stack.maxDepth = min(depth, MAX_DEPTH)
+}
+
+// SetContext makes the program stop with a BudgetError once ctx is done.
+func (i *Interpreter) SetContext(ctx context.Context) {
+	i.budget.SetContext(ctx)
+}
+
+// SetMaxSteps limits how many steps the program may take from now on:
+// loop iterations and calls to Lox functions and classes each count as
+// one, while other statements and calls to natives are free. Zero means no
+// limit.
+func (i *Interpreter) SetMaxSteps(steps int) {
+	i.budget.SetMaxSteps(steps)
+}
+
+// SetMaxBytes limits how many bytes the program may allocate from now on,
+// as counted by Quota. Zero means no limit.
+func (i *Interpreter) SetMaxBytes(bytes int) {
+	i.quota.SetMaxBytes(bytes)
+}
+
+func (i *Interpreter) Stdout() io.Writer {
+	return i.stdout
 }
 
 func (i *Interpreter) Interpret(expr ast.Expr) (any, error) {
 	return expr.Accept(i)
 }
 
+// Global returns the value of a global variable or builtin.
+func (i *Interpreter) Global(name string) (any, bool) {
+	for environment := i.globals; environment != nil; environment = environment.enclosing {
+		if value, ok := environment.values[name]; ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// Define creates or overwrites a global variable.
+func (i *Interpreter) Define(name string, value any) {
+	i.globals.define(name, value)
+}
+
+// CallValue calls a Lox function, class or native from Go code, with the
+// same arity checks as a call expression.
+func (i *Interpreter) CallValue(callee any, arguments []any) (any, error) {
+	callable, ok := callee.(LoxCallable)
+	if !ok {
+		return nil, fmt.Errorf("function is not callable: %v", callee)
+	}
+	if arity := callable.Arity(); arity != VARIADIC && arity != len(arguments) {
+		return nil, fmt.Errorf("expected %d arguments but got %d", arity, len(arguments))
+	}
+	i.stack.enter(token.Token{})
+	return callable.Call(*i, arguments)
+}
+
 func (i *Interpreter) VisitPrintStmt(s *ast.PrintStmt) (any, error) {
 	value, err := s.Expr.Accept(i)
 	if err != nil {
 		return nil, err
 	}
-	if value == nil {
-		fmt.Println("nil")
-	} else if num, ok := value.(float64); ok {
-		fmt.Println(util.FormatFloat(num, "run"))
-	} else {
-		fmt.Println(value)
-	}
+	fmt.Fprintln(i.stdout, Stringify(value))
 	return nil, nil
 }
 
@@ -62,6 +185,9 @@ func (i *Interpreter) VisitVarStmt(s *ast.VarStmt) (any, error) {
 			return nil, err
 		}
 	}
+	if err := i.quota.Allocate(s.Name, valueSize); err != nil {
+		return nil, err
+	}
 	i.environment.define(s.Name.Lexeme, value)
 
 	return nil, nil
@@ -73,7 +199,10 @@ func (i *Interpreter) VisitExpressionStmt(s *ast.ExpressionStmt) (any, error) {
 }
 
 func (i *Interpreter) VisitBlockStmt(s *ast.BlockStmt) (any, error) {
-	return nil, i.executeBlock(s.Statements, newEnvironment(&i.environment))
+	if err := i.quota.Allocate(s.LeftBrace, environmentSize); err != nil {
+		return nil, err
+	}
+	return i.executeBlock(s.Statements, newEnvironment(i.environment))
 }
 
 func (i *Interpreter) VisitIfStmt(s *ast.IfStmt) (any, error) {
@@ -91,6 +220,27 @@ func (i *Interpreter) VisitIfStmt(s *ast.IfStmt) (any, error) {
 	return nil, nil
 }
 
+type completionKind int
+
+const (
+	RETURN completionKind = iota
+	BREAK
+	CONTINUE
+)
+
+// completion is what a statement visitor returns when control leaves it
+// abruptly. Statements that complete normally return nil. Blocks stop at the
+// first completion and pass it on, until a loop or function call handles it.
+type completion struct {
+	kind  completionKind
+	value any
+}
+
+var (
+	breakCompletion    = &completion{kind: BREAK}
+	continueCompletion = &completion{kind: CONTINUE}
+)
+
 func (i *Interpreter) VisitWhileStmt(s *ast.WhileStmt) (any, error) {
 	for {
 		condition, err := s.Condition.Accept(i)
@@ -101,15 +251,46 @@ func (i *Interpreter) VisitWhileStmt(s *ast.WhileStmt) (any, error) {
 			break
 		}
 
-		if _, err := s.Body.Accept(i); err != nil {
+		result, err := s.Body.Accept(i)
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := result.(*completion); ok {
+			if c.kind == BREAK {
+				break
+			}
+			if c.kind == RETURN {
+				return c, nil
+			}
+		}
+
+		if s.Increment != nil {
+			if _, err := s.Increment.Accept(i); err != nil {
+				return nil, err
+			}
+		}
+		// Like the vm's loop instruction, a step is taken on the way back to
+		// the condition.
+		if err := i.budget.Spend(s.Keyword.Span()); err != nil {
 			return nil, err
 		}
 	}
 	return nil, nil
 }
 
+func (i *Interpreter) VisitBreakStmt(s *ast.BreakStmt) (any, error) {
+	return breakCompletion, nil
+}
+
+func (i *Interpreter) VisitContinueStmt(s *ast.ContinueStmt) (any, error) {
+	return continueCompletion, nil
+}
+
 func (i *Interpreter) VisitFunctionStmt(s *ast.FunctionStmt) (any, error) {
-	function := newLoxFunction(*s, i.environment, false)
+	if err := i.quota.Allocate(s.Name, closureSize); err != nil {
+		return nil, err
+	}
+	function := newLoxFunction(*s, i.environment, false, i.module)
 	i.environment.define(s.Name.Lexeme, function)
 	return nil, nil
 }
@@ -123,7 +304,45 @@ func (i *Interpreter) VisitReturnStmt(stmt *ast.ReturnStmt) (any, error) {
 			return nil, err
 		}
 	}
-	panic(LoxFunctionReturnValue{Value: value})
+	return &completion{kind: RETURN, value: value}, nil
+}
+
+func (i *Interpreter) VisitThrowStmt(stmt *ast.ThrowStmt) (any, error) {
+	value, err := stmt.Value.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+	return nil, newThrow(stmt.Keyword, value)
+}
+
+// VisitTryStmt runs the finally clause however the body and catch clause
+// complete, unless the program ran out of budget. If the finally clause
+// itself completes abruptly, that replaces the pending error or completion.
+func (i *Interpreter) VisitTryStmt(stmt *ast.TryStmt) (any, error) {
+	result, err := stmt.Body.Accept(i)
+	var runtimeErr RuntimeError
+	if stmt.Catch != nil && errors.As(err, &runtimeErr) {
+		result, err = i.executeCatch(stmt, runtimeErr)
+	}
+
+	var budgetErr BudgetError
+	var exitErr ExitError
+	if stmt.Finally != nil && !errors.As(err, &budgetErr) && !errors.As(err, &exitErr) {
+		finallyResult, finallyErr := stmt.Finally.Accept(i)
+		if finallyErr != nil || finallyResult != nil {
+			return finallyResult, finallyErr
+		}
+	}
+	return result, err
+}
+
+func (i *Interpreter) executeCatch(stmt *ast.TryStmt, runtimeErr RuntimeError) (any, error) {
+	if err := i.quota.Allocate(stmt.CatchName, environmentSize+valueSize); err != nil {
+		return nil, err
+	}
+	environment := newEnvironment(i.environment)
+	environment.define(stmt.CatchName.Lexeme, i.errorValue(runtimeErr))
+	return i.executeBlock([]ast.Stmt{stmt.Catch}, environment)
 }
 
 func (i *Interpreter) VisitClassStmt(stmt *ast.ClassStmt) (any, error) {
@@ -135,28 +354,31 @@ func (i *Interpreter) VisitClassStmt(stmt *ast.ClassStmt) (any, error) {
 		}
 		cls, ok := value.(class)
 		if !ok {
-			return nil, RuntimeError{Message: "Superclass must be a class", Line: stmt.Name.Line}
+			return nil, newRuntimeError(stmt.Name, "Superclass must be a class")
 		}
 		superclass = &cls
 	}
 
-	i.environment.define(stmt.Name.Lexeme, nil)
-
+	// Methods look the class up by name only when called, so it is defined
+	// once it exists, keeping local slots in declaration order.
+	if err := i.quota.Allocate(stmt.Name, closureSize*(len(stmt.Methods)+1)); err != nil {
+		return nil, err
+	}
 	if superclass != nil {
-		env := newEnvironment(&i.environment)
+		env := newEnvironment(i.environment)
 		env.define("super", *superclass)
 		i.environment = env
 	}
-
 	methods := make(map[string]*LoxFunction, 0)
 	for _, functionStmt := range stmt.Methods {
-		method := newLoxFunction(functionStmt, i.environment, functionStmt.Name.Lexeme == "init")
+		method := newLoxFunction(functionStmt, i.environment, functionStmt.Name.Lexeme == "init", i.module)
+		method.className = stmt.Name.Lexeme
 		methods[functionStmt.Name.Lexeme] = method
 	}
 	class := newClass(stmt.Name.Lexeme, superclass, methods)
 
 	if superclass != nil {
-		i.environment = *i.environment.enclosing
+		i.environment = i.environment.enclosing
 	}
 
 	i.environment.define(stmt.Name.Lexeme, class)
@@ -173,9 +395,9 @@ func (i *Interpreter) VisitAssignmentExpr(e *ast.AssignmentExpr) (any, error) {
 		return nil, err
 	}
 
-	distance, ok := i.locals[e]
-	if ok {
-		return value, i.environment.assignAt(distance, e.Name, value)
+	if local, ok := i.locals[e]; ok {
+		i.environment.assignAt(local.depth, local.slot, value)
+		return value, nil
 	} else {
 		return i.globals.assign(e.Name, value)
 	}
@@ -190,7 +412,10 @@ func (i *Interpreter) VisitGroupingExpr(e *ast.GroupingExpr) (any, error) {
 }
 
 func (i *Interpreter) VisitUnaryExpr(e *ast.UnaryExpr) (any, error) {
-	rightEval, _ := e.Right.Accept(i)
+	rightEval, err := e.Right.Accept(i)
+	if err != nil {
+		return nil, err
+	}
 
 	switch e.Operator.Type {
 	case token.MINUS:
@@ -206,8 +431,14 @@ func (i *Interpreter) VisitUnaryExpr(e *ast.UnaryExpr) (any, error) {
 }
 
 func (i *Interpreter) VisitBinaryExpr(e *ast.BinaryExpr) (any, error) {
-	leftEval, _ := e.Left.Accept(i)
-	rightEval, _ := e.Right.Accept(i)
+	leftEval, err := e.Left.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+	rightEval, err := e.Right.Accept(i)
+	if err != nil {
+		return nil, err
+	}
 
 	switch e.Operator.Type {
 	case token.STAR:
@@ -223,6 +454,9 @@ func (i *Interpreter) VisitBinaryExpr(e *ast.BinaryExpr) (any, error) {
 	case token.PLUS:
 		if leftStr, leftOk := leftEval.(string); leftOk {
 			if rightStr, rightOk := rightEval.(string); rightOk {
+				if err := i.quota.Allocate(e.Operator, len(leftStr)+len(rightStr)); err != nil {
+					return nil, err
+				}
 				return leftStr + rightStr, nil
 			}
 		}
@@ -257,9 +491,9 @@ func (i *Interpreter) VisitBinaryExpr(e *ast.BinaryExpr) (any, error) {
 		}
 		return leftEval.(float64) <= rightEval.(float64), nil
 	case token.EQUAL_EQUAL:
-		return leftEval == rightEval, nil
+		return i.isEqual(leftEval, rightEval), nil
 	case token.BANG_EQUAL:
-		return leftEval != rightEval, nil
+		return !i.isEqual(leftEval, rightEval), nil
 	default:
 		return nil, fmt.Errorf("unknown operator: %v", e.Operator.Lexeme)
 	}
@@ -284,9 +518,22 @@ func (i *Interpreter) VisitLogicalExpr(e *ast.LogicalExpr) (any, error) {
 	return e.Right.Accept(i)
 }
 
+func (i *Interpreter) VisitFunctionExpr(e *ast.FunctionExpr) (any, error) {
+	declaration := ast.FunctionStmt{
+		Keyword:    e.Keyword,
+		Parameters: e.Parameters,
+		Body:       e.Body,
+		RightBrace: e.RightBrace,
+	}
+	if err := i.quota.Allocate(e.Keyword, closureSize); err != nil {
+		return nil, err
+	}
+	return newLoxFunction(declaration, i.environment, false, i.module), nil
+}
+
 func (i *Interpreter) VisitCallExpr(e *ast.CallExpr) (any, error) {
 	if _, ok := e.Callee.(*ast.ThisExpr); ok {
-		return nil, RuntimeError{Message: "can only call functions and classes", Line: e.Paren.Line}
+		return nil, newRuntimeError(e.Paren, "can only call functions and classes")
 	}
 	callee, err := e.Callee.Accept(i)
 	if err != nil {
@@ -304,15 +551,33 @@ func (i *Interpreter) VisitCallExpr(e *ast.CallExpr) (any, error) {
 
 	callable, ok := callee.(LoxCallable)
 	if !ok {
-		return nil, fmt.Errorf("function is not callable: %v", callee)
+		return nil, newRuntimeError(e.Paren, fmt.Sprintf("function is not callable: %v", callee))
+	}
+	if arity := callable.Arity(); arity != VARIADIC && arity != len(args) {
+		return nil, newRuntimeError(e.Paren, fmt.Sprintf("expected %d arguments but got %d", arity, len(args)))
 	}
-	if callable.Arity() != len(args) {
-		return nil, RuntimeError{
-			Message: fmt.Sprintf("expected %d arguments but got %d", callable.Arity(), len(args)),
-			Line:    e.Paren.Line,
+
+	if native, ok := callable.(*NativeFunction); ok {
+		value, err := native.invoke(i.quota, i.budget, args)
+		if err != nil {
+			var runtimeErr RuntimeError
+			var exitErr ExitError
+			var budgetErr BudgetError
+			if errors.As(err, &runtimeErr) || errors.As(err, &exitErr) {
+				return nil, err
+			}
+			if errors.As(err, &budgetErr) {
+				return nil, NewBudgetError(e.Paren.Span(), budgetErr.Cause)
+			}
+			return nil, newRuntimeError(e.Paren, err.Error())
 		}
+		return value, nil
 	}
 
+	if err := i.budget.Spend(e.Paren.Span()); err != nil {
+		return nil, err
+	}
+	i.stack.enter(e.Paren)
 	return callable.Call(*i, args)
 }
 
@@ -322,11 +587,39 @@ func (i *Interpreter) VisitGetExpr(e *ast.GetExpr) (any, error) {
 		return nil, err
 	}
 
+	if s, ok := object.(string); ok {
+		if property, ok := StringProperty(s, e.Name.Lexeme); ok {
+			return property, nil
+		}
+		return nil, newRuntimeError(e.Name, fmt.Sprintf("undefined property %s", e.Name.Lexeme))
+	}
+	if builtin, ok := object.(BuiltinObject); ok {
+		if method, ok := builtin.Method(e.Name.Lexeme); ok {
+			return method, nil
+		}
+		return nil, newRuntimeError(e.Name, fmt.Sprintf("undefined property %s", e.Name.Lexeme))
+	}
+
+	if m, ok := object.(*module); ok {
+		return m.get(e.Name)
+	}
+	if ns, ok := object.(*Namespace); ok {
+		if member, ok := ns.Member(e.Name.Lexeme); ok {
+			return member, nil
+		}
+		return nil, newRuntimeError(e.Name, fmt.Sprintf("undefined property %s", e.Name.Lexeme))
+	}
+
 	instance, ok := object.(instance)
 	if !ok {
-		return nil, RuntimeError{Message: "only instances have properties", Line: e.Name.Line}
+		return nil, newRuntimeError(e.Name, "only instances have properties")
 	}
 
+	if _, isField := instance.fields[e.Name.Lexeme]; !isField {
+		if err := i.quota.Allocate(e.Name, closureSize+environmentSize); err != nil {
+			return nil, err
+		}
+	}
 	return instance.get(e.Name)
 }
 
@@ -338,34 +631,132 @@ func (i *Interpreter) VisitSetExpr(e *ast.SetExpr) (any, error) {
 
 	instance, ok := object.(instance)
 	if !ok {
-		return nil, RuntimeError{Message: "only instances have properties", Line: e.Name.Line}
+		return nil, newRuntimeError(e.Name, "only instances have properties")
 	}
 
 	value, err := e.Value.Accept(i)
 	if err != nil {
 		return nil, err
 	}
+	if _, exists := instance.fields[e.Name.Lexeme]; !exists {
+		if err := i.quota.Allocate(e.Name, valueSize+len(e.Name.Lexeme)); err != nil {
+			return nil, err
+		}
+	}
 	instance.set(e.Name, value)
 	return value, nil
 }
 
+func (i *Interpreter) VisitListExpr(e *ast.ListExpr) (any, error) {
+	elements := make([]Value, 0, len(e.Elements))
+	for _, element := range e.Elements {
+		value, err := element.Accept(i)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, value)
+	}
+	if err := i.quota.Allocate(e.LeftBracket, valueSize*len(elements)); err != nil {
+		return nil, err
+	}
+	return NewLoxList(elements), nil
+}
+
+func (i *Interpreter) VisitMapExpr(e *ast.MapExpr) (any, error) {
+	if err := i.quota.Allocate(e.LeftBrace, 2*valueSize*len(e.Keys)); err != nil {
+		return nil, err
+	}
+	m := NewLoxMap()
+	for index, keyExpr := range e.Keys {
+		key, err := keyExpr.Accept(i)
+		if err != nil {
+			return nil, err
+		}
+		value, err := e.Values[index].Accept(i)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.Set(key, value); err != nil {
+			return nil, newRuntimeError(e.LeftBrace, err.Error())
+		}
+	}
+	return m, nil
+}
+
+func (i *Interpreter) VisitIndexExpr(e *ast.IndexExpr) (any, error) {
+	object, err := e.Object.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+	index, err := e.Index.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := GetIndex(object, index)
+	if err != nil {
+		return nil, newRuntimeError(e.Bracket, err.Error())
+	}
+	return value, nil
+}
+
+func (i *Interpreter) VisitIndexSetExpr(e *ast.IndexSetExpr) (any, error) {
+	object, err := e.Object.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+	index, err := e.Index.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+	value, err := e.Value.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	if m, ok := object.(*LoxMap); ok {
+		if has, err := m.Has(index); err == nil && !has {
+			if err := i.quota.Allocate(e.Bracket, 2*valueSize); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := SetIndex(object, index, value); err != nil {
+		return nil, newRuntimeError(e.Bracket, err.Error())
+	}
+	return value, nil
+}
+
 func (i *Interpreter) VisitThisExpr(e *ast.ThisExpr) (any, error) {
 	return i.lookupVariable(e.Keyword, e)
 }
 
 func (i *Interpreter) VisitSuperExpr(e *ast.SuperExpr) (any, error) {
-	distance := i.locals[e]
-	val, _ := i.environment.getAt(distance, "super")
-	superclass := val.(class)
-	val, _ = i.environment.getAt(distance-1, "this")
-	this := val.(instance)
+	// super and this are the only variables in their scopes.
+	distance := i.locals[e].depth
+	superclass := i.environment.getAt(distance, 0).(class)
+	this := i.environment.getAt(distance-1, 0).(instance)
 	method := superclass.findMethod(e.Method.Lexeme)
 	if method == nil {
-		return nil, RuntimeError{Message: fmt.Sprintf("undefined property %s", e.Method.Lexeme), Line: e.Keyword.Line}
+		return nil, newRuntimeError(e.Keyword, fmt.Sprintf("undefined property %s", e.Method.Lexeme))
+	}
+	if err := i.quota.Allocate(e.Method, closureSize+environmentSize); err != nil {
+		return nil, err
 	}
 	return method.bind(this), nil
 }
 
+// Stringify formats a Lox value the way print shows it.
+func Stringify(value any) string {
+	if value == nil {
+		return "nil"
+	}
+	if num, ok := value.(float64); ok {
+		return util.FormatFloat(num, "run")
+	}
+	return fmt.Sprint(value)
+}
+
 func (i *Interpreter) isTruthy(v any) bool {
 	if v == nil {
 		return false
@@ -376,9 +767,23 @@ func (i *Interpreter) isTruthy(v any) bool {
 	return true
 }
 
+// isEqual compares instances and classes by identity. Their structs hold
+// maps, so comparing them with == would panic.
+func (i *Interpreter) isEqual(a, b any) bool {
+	switch a := a.(type) {
+	case instance:
+		b, ok := b.(instance)
+		return ok && reflect.ValueOf(a.fields).Pointer() == reflect.ValueOf(b.fields).Pointer()
+	case class:
+		b, ok := b.(class)
+		return ok && reflect.ValueOf(a.methods).Pointer() == reflect.ValueOf(b.methods).Pointer()
+	}
+	return a == b
+}
+
 func (i *Interpreter) checkNumberOperand(operator token.Token, operand any) error {
 	if _, ok := operand.(float64); !ok {
-		return RuntimeError{Message: "Operand must be a number.", Line: operator.Line}
+		return newRuntimeError(operator, "Operand must be a number.")
 	}
 	return nil
 }
@@ -388,13 +793,15 @@ func (i *Interpreter) checkNumberOperands(operator token.Token, left, right any)
 	_, rightOk := right.(float64)
 
 	if !leftOk || !rightOk {
-		return RuntimeError{Message: "Operands must be numbers.", Line: operator.Line}
+		return newRuntimeError(operator, "Operands must be numbers.")
 	}
 
 	return nil
 }
 
-func (i *Interpreter) executeBlock(statements []ast.Stmt, environment Environment) error {
+// executeBlock runs statements in environment and returns the first
+// completion or error, which ends the block early.
+func (i *Interpreter) executeBlock(statements []ast.Stmt, environment *Environment) (any, error) {
 	previousEnv := i.environment
 
 	defer func() {
@@ -404,25 +811,31 @@ func (i *Interpreter) executeBlock(statements []ast.Stmt, environment Environmen
 	i.environment = environment
 
 	for _, stmt := range statements {
-		_, err := stmt.Accept(i)
-		if err != nil {
-			return err
+		result, err := stmt.Accept(i)
+		if err != nil || result != nil {
+			return result, err
 		}
 	}
 
-	return nil
+	return nil, nil
 }
 
 func (i *Interpreter) lookupVariable(name token.Token, expr ast.Expr) (any, error) {
-	if distance, ok := i.locals[expr]; ok {
-		result, err := i.environment.getAt(distance, name.Lexeme)
-		return result, err
+	if local, ok := i.locals[expr]; ok {
+		return i.environment.getAt(local.depth, local.slot), nil
 	} else {
 		result, err := i.globals.get(name)
 		return result, err
 	}
 }
 
-func (i *Interpreter) resolve(expr ast.Expr, depth int) {
-	i.locals[expr] = depth
+// local locates a resolved local variable: depth scopes out from where it
+// is used, at slot in that scope.
+type local struct {
+	depth int
+	slot  int
+}
+
+func (i *Interpreter) resolve(expr ast.Expr, depth, slot int) {
+	i.locals[expr] = local{depth: depth, slot: slot}
 }
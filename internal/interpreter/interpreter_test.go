@@ -0,0 +1,1004 @@
+package interpreter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+// run executes source the way the run command does and returns its stdout,
+// its stderr without source snippets, and its exit code. configure, if
+// given, sets up the interpreter before the program runs.
+func run(source string, configure ...func(*Interpreter)) (string, string, int) {
+	var stdout, stderr strings.Builder
+
+	sc := scanner.NewScanner(source)
+	tokens, err := sc.ScanTokens()
+	if err != nil {
+		fmt.Fprintln(&stderr, err)
+		return stdout.String(), stderr.String(), 65
+	}
+
+	statements, parseErrors := parser.NewParser(tokens).Parse()
+	if len(parseErrors) > 0 {
+		for _, err := range parseErrors {
+			fmt.Fprintln(&stderr, err)
+		}
+		return stdout.String(), stderr.String(), 65
+	}
+
+	interpreter := NewInterpreter()
+	interpreter.SetStdout(&stdout)
+	for _, f := range configure {
+		f(&interpreter)
+	}
+	resolver := NewResolver(interpreter)
+	if _, err := resolver.Resolve(statements); err != nil {
+		fmt.Fprintln(&stderr, err)
+		return stdout.String(), stderr.String(), 65
+	}
+
+	for _, stmt := range statements {
+		if _, err := stmt.Accept(&interpreter); err != nil {
+			fmt.Fprintln(&stderr, err)
+			return stdout.String(), stderr.String(), 70
+		}
+	}
+	return stdout.String(), stderr.String(), 0
+}
+
+// evaluate executes source the way the evaluate command does, printing the
+// value of each expression.
+func evaluate(source string) (string, string, int) {
+	var stdout, stderr strings.Builder
+
+	sc := scanner.NewScanner(source)
+	tokens, err := sc.ScanTokens()
+	if err != nil {
+		fmt.Fprintln(&stderr, err)
+		return stdout.String(), stderr.String(), 65
+	}
+	expressions, parseErrors := parser.NewParser(tokens).ParseExpressions()
+	if len(parseErrors) > 0 {
+		for _, err := range parseErrors {
+			fmt.Fprintln(&stderr, err)
+		}
+		return stdout.String(), stderr.String(), 65
+	}
+
+	interpreter := NewInterpreter()
+	interpreter.SetStdout(&stdout)
+	resolver := NewResolver(interpreter)
+	for _, expression := range expressions {
+		if _, err := resolver.Resolve([]ast.Stmt{&ast.ExpressionStmt{Expr: expression}}); err != nil {
+			fmt.Fprintln(&stderr, err)
+			return stdout.String(), stderr.String(), 65
+		}
+	}
+	for _, expression := range expressions {
+		value, err := interpreter.Interpret(expression)
+		if err != nil {
+			fmt.Fprintln(&stderr, err)
+			return stdout.String(), stderr.String(), 70
+		}
+		fmt.Fprintln(&stdout, Stringify(value))
+	}
+	return stdout.String(), stderr.String(), 0
+}
+
+func mustParse(t *testing.T, source string) []ast.Stmt {
+	t.Helper()
+
+	sc := scanner.NewScanner(source)
+	tokens, err := sc.ScanTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, parseErrors := parser.NewParser(tokens).Parse()
+	if len(parseErrors) > 0 {
+		t.Fatal(parseErrors[0])
+	}
+	return statements
+}
+
+// runtimeErrorTests are programs run the way the run command does, with
+// the output they must give. backends_test.go runs them on the vm too.
+var runtimeErrorTests = []struct {
+	name   string
+	source string
+	stdout string
+	stderr string
+	code   int
+}{
+	{
+		name:   "ok",
+		source: "print 1 + 2;",
+		stdout: "3\n",
+	},
+	{
+		name:   "negate string",
+		source: "print 1;\nprint -\"a\";",
+		stdout: "1\n",
+		stderr: "Operand must be a number.\n[line 2]\n",
+		code:   70,
+	},
+	{
+		name:   "add number and string",
+		source: "print 1 + \"a\";",
+		stderr: "Operands must be numbers.\n[line 1]\n",
+		code:   70,
+	},
+	{
+		name:   "undefined variable",
+		source: "print x;",
+		stderr: "undefined variable x\n[line 1]\n",
+		code:   70,
+	},
+	{
+		name:   "error in left operand",
+		source: "class A {}\nvar a = A();\nprint\n  a.missing + 1;",
+		stderr: "undefined property missing\n[line 4]\n",
+		code:   70,
+	},
+	{
+		name:   "error in right operand",
+		source: "class A {}\nvar a = A();\nprint 1 <\n  a.missing;",
+		stderr: "undefined property missing\n[line 4]\n",
+		code:   70,
+	},
+	{
+		name:   "error in equality operand",
+		source: "print nil ==\n  undefined;",
+		stderr: "undefined variable undefined\n[line 2]\n",
+		code:   70,
+	},
+	{
+		name:   "error in negated operand",
+		source: "fun f() { return -g(); }\nfun g() {\n  return -\"a\";\n}\nf();",
+		stderr: "Operand must be a number.\n[line 3]\n",
+		code:   70,
+	},
+	{
+		name:   "error in not operand",
+		source: "print !\n  undefined;",
+		stderr: "undefined variable undefined\n[line 2]\n",
+		code:   70,
+	},
+	{
+		name:   "error inside call in operand",
+		source: "fun f() {\n  return nil + 1;\n}\nprint 1 + f();",
+		stderr: "Operands must be numbers.\n[line 2]\n",
+		code:   70,
+	},
+	{
+		name:   "output before error is kept",
+		source: "print \"before\";\nprint 1 - nil;\nprint \"after\";",
+		stdout: "before\n",
+		stderr: "Operands must be numbers.\n[line 2]\n",
+		code:   70,
+	},
+	{
+		name:   "instance equality",
+		source: "class A {}\nvar a = A();\nprint a == a;\nprint a == A();\nprint A == A;\nprint a != nil;",
+		stdout: "true\nfalse\ntrue\ntrue\n",
+	},
+	{
+		name:   "call non-callable",
+		source: "\"a\"();",
+		stderr: "function is not callable: a\n[line 1]\n",
+		code:   70,
+	},
+	{
+		name:   "caught error",
+		source: "try {\n  print -nil;\n} catch (e) {\n  print e.message;\n  print e.line;\n}",
+		stdout: "Operand must be a number.\n2\n",
+	},
+	{
+		name:   "uncaught throw",
+		source: "throw Error(\"boom\");",
+		stderr: "boom\n[line 1]\n",
+		code:   70,
+	},
+	{
+		name:   "closures capture loop variables",
+		source: "var fns = [];\nfor (var i = 0; i < 3; i = i + 1) {\n  var j = i;\n  fns.push(fun () { return i * 10 + j; });\n}\nfor (var k = 0; k < 3; k = k + 1) print fns[k]();",
+		stdout: "30\n31\n32\n",
+	},
+	{
+		name:   "local recursive function",
+		source: "{\n  fun fact(n) { if (n < 2) return 1; return n * fact(n - 1); }\n  print fact(5);\n}",
+		stdout: "120\n",
+	},
+	{
+		name:   "shadowed catch variable",
+		source: "{\n  var e = \"outer\";\n  try { throw \"inner\"; } catch (e) { print e; }\n  print e;\n}",
+		stdout: "inner\nouter\n",
+	},
+	{
+		name:   "unbounded recursion",
+		source: "fun f() {\n  f();\n}\nf();",
+		stderr: "Stack overflow.\n[line 2]\n",
+		code:   70,
+	},
+	{
+		name:   "deep recursion within limit",
+		source: "fun f(n) {\n  if (n == 0) return 0;\n  return 1 + f(n - 1);\n}\nprint f(9999);",
+		stdout: "9999\n",
+	},
+	{
+		name:   "return outside function",
+		source: "return 1;",
+		stderr: "[line 1] Error at 'return': Can't return from top-level code\n",
+		code:   65,
+	},
+	{
+		name:   "unterminated multi-line string",
+		source: "print 1;\nvar s = \"abc\ndef;",
+		stderr: "[line 2] Error: Unterminated string.\n",
+		code:   65,
+	},
+	{
+		name:   "set property on non-instance",
+		source: "fun p() {\n  print \"side\";\n}\ntry {\n  nil.x = p();\n} catch (e) {\n  print e.message;\n}",
+		stdout: "only instances have properties\n",
+	},
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	for _, test := range runtimeErrorTests {
+		t.Run(test.name, func(t *testing.T) {
+			stdout, stderr, code := run(test.source)
+			if stdout != test.stdout {
+				t.Errorf("stdout = %q, want %q", stdout, test.stdout)
+			}
+			if stderr != test.stderr {
+				t.Errorf("stderr = %q, want %q", stderr, test.stderr)
+			}
+			if code != test.code {
+				t.Errorf("exit code = %d, want %d", code, test.code)
+			}
+		})
+	}
+}
+
+func TestTrace(t *testing.T) {
+	source := `class A {
+  run() {
+    return fail();
+  }
+}
+fun fail() {
+  return -nil;
+}
+A().run();`
+	statements := mustParse(t, source)
+	interpreter := NewInterpreter()
+	interpreter.SetStdout(io.Discard)
+	resolver := NewResolver(interpreter)
+	if _, err := resolver.Resolve(statements); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	for _, stmt := range statements {
+		if _, err = stmt.Accept(&interpreter); err != nil {
+			break
+		}
+	}
+
+	var runtimeErr RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("got %v, want a runtime error", err)
+	}
+	want := []Frame{
+		{Function: "run", Class: "A", Line: 9},
+		{Function: "fail", Line: 3},
+	}
+	if !slices.Equal(runtimeErr.Trace, want) {
+		t.Errorf("trace = %v, want %v", runtimeErr.Trace, want)
+	}
+
+	traceback := "Traceback (most recent call last):\n" +
+		"  line 9, in <script>\n" +
+		"  line 3, in A.run\n" +
+		"  line 7, in fail\n"
+	if got := runtimeErr.Traceback(); got != traceback {
+		t.Errorf("traceback = %q, want %q", got, traceback)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		maxSteps int
+		cause    error
+		line     int
+	}{
+		{name: "step limit", ctx: context.Background(), maxSteps: 100, cause: ErrStepLimit, line: 2},
+		{name: "cancelled", ctx: cancelled, cause: context.Canceled, line: 2},
+	}
+
+	source := `try {
+  while (true) {}
+} catch (e) {
+  print "caught";
+} finally {
+  print "finally";
+}`
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statements := mustParse(t, source)
+			var stdout strings.Builder
+			interpreter := NewInterpreter()
+			interpreter.SetStdout(&stdout)
+			interpreter.SetContext(test.ctx)
+			interpreter.SetMaxSteps(test.maxSteps)
+
+			_, err := statements[0].Accept(&interpreter)
+			var budgetErr BudgetError
+			if !errors.As(err, &budgetErr) || !errors.Is(err, test.cause) {
+				t.Fatalf("got %v, want a budget error caused by %v", err, test.cause)
+			}
+			if budgetErr.Line != test.line {
+				t.Errorf("line = %d, want %d", budgetErr.Line, test.line)
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("stdout = %q, want no output", stdout.String())
+			}
+		})
+	}
+}
+
+// TestReadLineHonoursContext checks that a program waiting for input
+// stops once its context is done, with an error it can't catch.
+func TestReadLineHonoursContext(t *testing.T) {
+	stdin, _ := io.Pipe()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var stdout strings.Builder
+	interpreter := NewInterpreter()
+	interpreter.SetStdout(&stdout)
+	interpreter.Install(System(SystemOptions{Stdin: stdin, Stdout: &stdout}))
+	interpreter.SetContext(ctx)
+
+	statements := mustParse(t, "try {\n  readLine();\n} catch (e) {\n  print \"caught\";\n}")
+	_, err := statements[0].Accept(&interpreter)
+	var budgetErr BudgetError
+	if !errors.As(err, &budgetErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a budget error caused by the deadline", err)
+	}
+	if budgetErr.Line != 2 {
+		t.Errorf("line = %d, want 2", budgetErr.Line)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("stdout = %q, want no output", stdout.String())
+	}
+}
+
+// TestQuotaKeepsScope checks that a declaration failing for lack of quota
+// leaves the interpreter in the global scope, as an embedding host that
+// keeps using it would see.
+func TestQuotaKeepsScope(t *testing.T) {
+	var stdout strings.Builder
+	interpreter := NewInterpreter()
+	interpreter.SetStdout(&stdout)
+	execute := func(source string) error {
+		statements := mustParse(t, source)
+		resolver := NewResolver(interpreter)
+		if _, err := resolver.Resolve(statements); err != nil {
+			t.Fatal(err)
+		}
+		for _, statement := range statements {
+			if _, err := statement.Accept(&interpreter); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	interpreter.SetMaxBytes(200)
+	err := execute("class Base {} class Big < Base { a() {} b() {} c() {} d() {} }")
+	if err == nil || !strings.Contains(err.Error(), "Memory quota exceeded.") {
+		t.Fatalf("error = %v, want memory quota exceeded", err)
+	}
+
+	interpreter.SetMaxBytes(0)
+	if err := execute("var x = 1;"); err != nil {
+		t.Fatal(err)
+	}
+	if err := execute("print x;"); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "1\n" {
+		t.Errorf("stdout = %q, want %q", stdout.String(), "1\n")
+	}
+}
+
+func TestQuota(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		maxBytes int
+		stdout   string
+		stderr   string
+		code     int
+	}{
+		{
+			name: "string doubling",
+			source: `var s = "x";
+var n = 0;
+while (true) {
+  s = s + s;
+  n = n + 1;
+  print n;
+}`,
+			maxBytes: 1000,
+			stdout:   "1\n2\n3\n4\n5\n6\n7\n",
+			stderr:   "Memory quota exceeded.\n[line 4]\n",
+			code:     70,
+		},
+		{
+			name: "growing instance chain",
+			source: `class Node {}
+var head = nil;
+var n = 0;
+while (true) {
+  var node = Node();
+  node.next = head;
+  head = node;
+  n = n + 1;
+}`,
+			maxBytes: 10000,
+			stderr:   "Memory quota exceeded.\n[line 5]\n",
+			code:     70,
+		},
+		{
+			name: "caught",
+			source: `var s = "x";
+try {
+  while (true) s = s + s;
+} catch (e) {
+  print e.message;
+}
+print "after";`,
+			maxBytes: 1 << 16,
+			stdout:   "Memory quota exceeded.\nafter\n",
+		},
+		{
+			name: "list push",
+			source: `var xs = [];
+for (var i = 0; i < 200000; i = i + 1) {
+  xs.push(i);
+}`,
+			maxBytes: 10000,
+			stderr:   "Memory quota exceeded.\n[line 3]\n",
+			code:     70,
+		},
+		{
+			name: "map growth",
+			source: `var m = {};
+var i = 0;
+while (true) {
+  m[i] = i;
+  i = i + 1;
+}`,
+			maxBytes: 10000,
+			stderr:   "Memory quota exceeded.\n[line 4]\n",
+			code:     70,
+		},
+		{
+			name: "string replace",
+			source: `var s = "x";
+for (var i = 0; i < 24; i = i + 1) {
+  s = s.replace("x", "xx");
+}`,
+			maxBytes: 10000,
+			stderr:   "Memory quota exceeded.\n[line 3]\n",
+			code:     70,
+		},
+		{
+			name: "str of shared lists",
+			source: `var a = [1];
+for (var i = 0; i < 22; i = i + 1) a = [a, a];
+str(a);`,
+			maxBytes: 1 << 20,
+			stderr:   "Memory quota exceeded.\n[line 3]\n",
+			code:     70,
+		},
+		{
+			name: "json of shared lists",
+			source: `var a = [1];
+for (var i = 0; i < 22; i = i + 1) a = [a, a];
+json.stringify(a);`,
+			maxBytes: 1 << 20,
+			stderr:   "Memory quota exceeded.\n[line 3]\n",
+			code:     70,
+		},
+		{
+			name: "string split",
+			source: `var s = ",";
+for (var i = 0; i < 12; i = i + 1) s = s + s;
+s.split(",");`,
+			maxBytes: 20000,
+			stderr:   "Memory quota exceeded.\n[line 3]\n",
+			code:     70,
+		},
+		{
+			name:     "within quota",
+			source:   `fun f(n) { if (n == 0) return "done"; return f(n - 1); } print f(10);`,
+			maxBytes: 10000,
+			stdout:   "done\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var used []int
+			for range 2 {
+				var quota *Quota
+				stdout, stderr, code := run(test.source, func(i *Interpreter) {
+					i.SetMaxBytes(test.maxBytes)
+					quota = i.quota
+				})
+				if stdout != test.stdout {
+					t.Errorf("stdout = %q, want %q", stdout, test.stdout)
+				}
+				if stderr != test.stderr {
+					t.Errorf("stderr = %q, want %q", stderr, test.stderr)
+				}
+				if code != test.code {
+					t.Errorf("exit code = %d, want %d", code, test.code)
+				}
+				if quota.Used() > test.maxBytes {
+					t.Errorf("used %d bytes, more than the quota of %d", quota.Used(), test.maxBytes)
+				}
+				used = append(used, quota.Used())
+			}
+			if used[0] != used[1] {
+				t.Errorf("used %d bytes, then %d on the same program", used[0], used[1])
+			}
+		})
+	}
+}
+
+func TestModules(t *testing.T) {
+	files := map[string]string{
+		"lib/strings.lox": `print "loading strings";
+var suffix = "!";
+export fun shout(s) { return s + suffix; }
+export var greeting = "hi";
+export class Box {
+  init(v) { this.v = v; }
+  show() { return shout(this.v); }
+}`,
+		"lib/broken.lox": `export fun fail() {
+  return nil + 1;
+}
+fail();`,
+		"a.lox":          `import "b.lox" as b;`,
+		"b.lox":          `import "a.lox" as a;`,
+		"search/far.lox": `export var far = "found on LOX_PATH";`,
+		"secret.txt":     "password hunter2",
+	}
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv(LOX_PATH_VARIABLE, filepath.Join(dir, "search"))
+
+	tests := []struct {
+		name   string
+		source string
+		stdout string
+		stderr string
+		code   int
+	}{
+		{
+			name: "import as",
+			source: `import "lib/strings.lox" as s;
+print s.shout(s.greeting);
+print s.Box("box").show();`,
+			stdout: "loading strings\nhi!\nbox!\n",
+		},
+		{
+			name: "from import runs once",
+			source: `from "lib/strings.lox" import shout, greeting;
+import "lib/strings.lox" as s;
+var suffix = "?";
+print shout(greeting);`,
+			stdout: "loading strings\nhi!\n",
+		},
+		{
+			name:   "LOX_PATH",
+			source: `from "far.lox" import far; print far;`,
+			stdout: "found on LOX_PATH\n",
+		},
+		{
+			name:   "private name",
+			source: `import "lib/strings.lox" as s; print s.suffix;`,
+			stdout: "loading strings\n",
+			stderr: "module " + filepath.Join(dir, "lib/strings.lox") + " has no export suffix\n[line 1]\n",
+			code:   70,
+		},
+		{
+			name:   "missing module",
+			source: `import "nowhere.lox" as n;`,
+			stderr: "Can't find module 'nowhere.lox'.\n[line 1]\n",
+			code:   70,
+		},
+		{
+			name:   "absolute path",
+			source: fmt.Sprintf("import %q as s;", filepath.Join(dir, "lib/strings.lox")),
+			stderr: fmt.Sprintf("Can't find module '%s'.\n[line 1]\n", filepath.Join(dir, "lib/strings.lox")),
+			code:   70,
+		},
+		{
+			name:   "outside the directory",
+			source: `import "lib/../../secret.txt" as s;`,
+			stderr: "Can't find module 'lib/../../secret.txt'.\n[line 1]\n",
+			code:   70,
+		},
+		{
+			name:   "not lox",
+			source: `import "secret.txt" as s;`,
+			stderr: "Can't load module 'secret.txt': syntax error on line 1.\n[line 1]\n",
+			code:   70,
+		},
+		{
+			name:   "cycle",
+			source: `import "a.lox" as a;`,
+			stderr: fmt.Sprintf("Import cycle: %[1]s -> %[2]s -> %[1]s.\n[line 1 in %[2]s]\n", filepath.Join(dir, "a.lox"), filepath.Join(dir, "b.lox")),
+			code:   70,
+		},
+		{
+			name:   "error in module",
+			source: `import "lib/broken.lox" as broken;`,
+			stderr: "Operands must be numbers.\n[line 2 in " + filepath.Join(dir, "lib/broken.lox") + "]\n",
+			code:   70,
+		},
+		{
+			name:   "import in block",
+			source: `{ import "lib/strings.lox" as s; }`,
+			stderr: "[line 1] Error at 'import': Can only import at the top level of a file\n",
+			code:   65,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdout, stderr, code := run(test.source, func(i *Interpreter) {
+				i.SetScriptPath(filepath.Join(dir, "main.lox"))
+			})
+			if stdout != test.stdout {
+				t.Errorf("stdout = %q, want %q", stdout, test.stdout)
+			}
+			if stderr != test.stderr {
+				t.Errorf("stderr = %q, want %q", stderr, test.stderr)
+			}
+			if code != test.code {
+				t.Errorf("exit code = %d, want %d", code, test.code)
+			}
+		})
+	}
+}
+
+func TestMath(t *testing.T) {
+	tests := []struct {
+		source string
+		stdout string
+		stderr string
+	}{
+		{source: `print math.sqrt(16);`, stdout: "4\n"},
+		{source: `print math.pow(2, 10);`, stdout: "1024\n"},
+		{source: `print math.floor(-1.5) + math.ceil(1.2);`, stdout: "0\n"},
+		{source: `print math.min(3, 1, 2) + math.max(4);`, stdout: "5\n"},
+		{source: `print math.atan2(1, 1) * 4 == math.pi;`, stdout: "true\n"},
+		{source: `print math.log(math.exp(2));`, stdout: "2\n"},
+		// The constants print like the results of arithmetic.
+		{source: `print math.inf; print -math.inf; print math.nan;`, stdout: "+Inf\n-Inf\nNaN\n"},
+		{source: `print 1 / 0; print -1 / 0; print math.inf == 1 / 0;`, stdout: "+Inf\n-Inf\ntrue\n"},
+		{source: `print math.isNaN(math.nan) and math.isInf(-math.inf);`, stdout: "true\n"},
+		{source: `print math.sqrt("16");`, stderr: "Argument 1 to math.sqrt must be a number.\n[line 1]\n"},
+		{source: `print math.round;`, stderr: "undefined property round\n[line 1]\n"},
+		{source: `print sqrt;`, stderr: "undefined variable sqrt\n[line 1]\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			stdout, stderr, _ := run(test.source)
+			if stdout != test.stdout {
+				t.Errorf("stdout = %q, want %q", stdout, test.stdout)
+			}
+			if stderr != test.stderr {
+				t.Errorf("stderr = %q, want %q", stderr, test.stderr)
+			}
+		})
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		source string
+		stdout string
+		stderr string
+	}{
+		{source: `print "héllo".length;`, stdout: "5\n"},
+		{source: `print "héllo"[1] + "héllo"[4];`, stdout: "éo\n"},
+		{source: `print "grüße".upper() + "ÀBC".lower();`, stdout: "GRÜßEàbc\n"},
+		{source: `print "a,b,,c".split(",");`, stdout: `["a", "b", "", "c"]` + "\n"},
+		{source: `print "wörld wörld".find("ld");`, stdout: "3\n"},
+		{source: `print "aaa".replace("a", "bb");`, stdout: "bbbbbb\n"},
+		{source: `print "  x  ".trim().length;`, stdout: "1\n"},
+		{source: `print "日本語です".substr(1, 3) + "日本語です".substr(3);`, stdout: "本語です\n"},
+		{source: `print str(12) + str(nil) + str(1 == 1);`, stdout: "12niltrue\n"},
+		{source: `print num("2.5") * 2; print num("two");`, stdout: "5\nnil\n"},
+		{source: `print chr(ord("é") + 1);`, stdout: "ê\n"},
+		{source: `print "abc"[3];`, stderr: "String index out of range.\n[line 1]\n"},
+		{source: `"abc"[0] = "x";`, stderr: "Strings can't be modified.\n[line 1]\n"},
+		{source: `"abc".find(nil);`, stderr: "Argument 1 to find must be a string.\n[line 1]\n"},
+		{source: `ord("");`, stderr: "Argument 1 to ord must be a single character.\n[line 1]\n"},
+		{source: `"abc".size;`, stderr: "undefined property size\n[line 1]\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			stdout, stderr, _ := run(test.source)
+			if stdout != test.stdout {
+				t.Errorf("stdout = %q, want %q", stdout, test.stdout)
+			}
+			if stderr != test.stderr {
+				t.Errorf("stderr = %q, want %q", stderr, test.stderr)
+			}
+		})
+	}
+}
+
+func TestSystem(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+	t.Setenv("LOX_TEST_VALUE", "from env")
+
+	tests := []struct {
+		name    string
+		source  string
+		options SystemOptions
+		stdout  string
+		stderr  string
+	}{
+		{
+			name:    "args",
+			source:  `print args();`,
+			options: SystemOptions{Args: []string{"a", "--b"}},
+			stdout:  `["a", "--b"]` + "\n",
+		},
+		{
+			name:   "readLine",
+			source: `var line = readLine(); while (line != nil) { print line.length; line = readLine(); }`,
+			stdout: "3\n0\n2\n",
+		},
+		{
+			name: "files",
+			source: fmt.Sprintf(`writeFile(%[1]q, "one\n");
+appendFile(%[1]q, "two");
+print readFile(%[1]q).split("\n");`, path),
+			options: SystemOptions{AllowFS: true},
+			stdout:  `["one", "two"]` + "\n",
+		},
+		{
+			name:    "missing file",
+			source:  fmt.Sprintf(`readFile(%q);`, filepath.Join(dir, "missing.txt")),
+			options: SystemOptions{AllowFS: true},
+			stderr:  fmt.Sprintf("Can't open %s: no such file or directory.\n[line 1]\n", filepath.Join(dir, "missing.txt")),
+		},
+		{
+			name:   "fs not allowed",
+			source: fmt.Sprintf(`writeFile(%q, "x");`, path),
+			stderr: "File system access is not allowed; run with --allow-fs.\n[line 1]\n",
+		},
+		{
+			name:    "env",
+			source:  `print env("LOX_TEST_VALUE"); print env("LOX_TEST_UNSET");`,
+			options: SystemOptions{AllowEnv: true},
+			stdout:  "from env\nnil\n",
+		},
+		{
+			name:   "env not allowed",
+			source: `env("LOX_TEST_VALUE");`,
+			stderr: "Environment access is not allowed; run with --allow-env.\n[line 1]\n",
+		},
+		{
+			name:   "exit skips catch and finally",
+			source: `try { exit(3); } catch (e) { print "caught"; } finally { print "finally"; }`,
+			stderr: "exit status 3\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.options.Stdin = strings.NewReader("one\n\nxy")
+			stdout, stderr, _ := run(test.source, func(i *Interpreter) {
+				i.Install(System(test.options))
+			})
+			if stdout != test.stdout {
+				t.Errorf("stdout = %q, want %q", stdout, test.stdout)
+			}
+			if stderr != test.stderr {
+				t.Errorf("stderr = %q, want %q", stderr, test.stderr)
+			}
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	// Lox strings can't contain double quotes, so sources spell them as
+	// single quotes and q turns them back.
+	const q = `fun q(s) { return s.replace("'", chr(34)); }` + "\n"
+	tests := []struct {
+		name   string
+		source string
+		stdout string
+		stderr string
+	}{
+		{
+			name:   "parse",
+			source: `var v = json.parse(q("{'b': [1, 2.5, true, null], 'a': {'s': 'é'}}")); print v; print v["a"]["s"].length;`,
+			stdout: `{"b": [1, 2.5, true, nil], "a": {"s": "é"}}` + "\n1\n",
+		},
+		{
+			name:   "stringify",
+			source: `print json.stringify({"n": 1, "list": [nil, false, "x"]});`,
+			stdout: `{"n":1,"list":[null,false,"x"]}` + "\n",
+		},
+		{
+			name:   "indent",
+			source: `print json.stringify({"a": [1], "b": {}}, 2);`,
+			stdout: "{\n  \"a\": [\n    1\n  ],\n  \"b\": {}\n}\n",
+		},
+		{
+			name:   "instance",
+			source: `class P { init() { this.y = 2; this.x = "1"; } } print json.stringify(P());`,
+			stdout: `{"x":"1","y":2}` + "\n",
+		},
+		{
+			name:   "round trip",
+			source: `var s = q("{'k':[1,{'z':0.5}],'e':'a'}"); print json.stringify(json.parse(s)) == s;`,
+			stdout: "true\n",
+		},
+		{
+			name:   "cycle",
+			source: `var m = {}; m["self"] = [m]; json.stringify(m);`,
+			stderr: "Can't encode a cyclic structure as JSON.\n[line 2]\n",
+		},
+		{
+			name:   "shared is not a cycle",
+			source: `var l = [1]; print json.stringify([l, l]);`,
+			stdout: "[[1],[1]]\n",
+		},
+		{
+			name:   "function",
+			source: `json.stringify([clock]);`,
+			stderr: "Can't encode <native fn clock> as JSON.\n[line 2]\n",
+		},
+		{
+			name:   "malformed",
+			source: `json.parse(q("{'a': 1,") + chr(10) + q("  'b': tru}"));`,
+			stderr: "Invalid JSON at line 2, column 11: invalid character '}' in literal true (expecting 'e').\n[line 2]\n",
+		},
+		{
+			name:   "truncated",
+			source: `json.parse("[1, 2");`,
+			stderr: "Invalid JSON at line 1, column 6: unexpected end of JSON input.\n[line 2]\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdout, stderr, _ := run(q + test.source)
+			if stdout != test.stdout {
+				t.Errorf("stdout = %q, want %q", stdout, test.stdout)
+			}
+			if stderr != test.stderr {
+				t.Errorf("stderr = %q, want %q", stderr, test.stderr)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		source string
+		stdout string
+		stderr string
+		code   int
+	}{
+		{source: "1 + 2", stdout: "3\n"},
+		{source: "x", stderr: "undefined variable x\n[line 1]\n", code: 70},
+		{source: "clock() > 0", stdout: "true\n"},
+		{source: "math.pi > 3", stdout: "true\n"},
+		{source: "fun (a) { return a; }(3)", stdout: "3\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			stdout, stderr, code := evaluate(test.source)
+			if stdout != test.stdout {
+				t.Errorf("stdout = %q, want %q", stdout, test.stdout)
+			}
+			if stderr != test.stderr {
+				t.Errorf("stderr = %q, want %q", stderr, test.stderr)
+			}
+			if code != test.code {
+				t.Errorf("exit code = %d, want %d", code, test.code)
+			}
+		})
+	}
+}
+
+// promptReader records what had been written to stdout when the program
+// first read from it.
+type promptReader struct {
+	stdout *strings.Builder
+	seen   *string
+	input  io.Reader
+}
+
+func (r promptReader) Read(p []byte) (int, error) {
+	if *r.seen == "" {
+		*r.seen = r.stdout.String()
+	}
+	return r.input.Read(p)
+}
+
+func TestReadLineFlushesStdout(t *testing.T) {
+	var stdout strings.Builder
+	var seen string
+	buffered := bufio.NewWriter(&stdout)
+
+	interpreter := NewInterpreter()
+	interpreter.SetStdout(buffered)
+	interpreter.Install(System(SystemOptions{
+		Stdin:  promptReader{stdout: &stdout, seen: &seen, input: strings.NewReader("bob\n")},
+		Stdout: buffered,
+	}))
+	statements := mustParse(t, `print "name?"; print "hi " + readLine();`)
+	resolver := NewResolver(interpreter)
+	if _, err := resolver.Resolve(statements); err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range statements {
+		if _, err := statement.Accept(&interpreter); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buffered.Flush()
+
+	if seen != "name?\n" {
+		t.Errorf("stdout before reading = %q, want %q", seen, "name?\n")
+	}
+	if stdout.String() != "name?\nhi bob\n" {
+		t.Errorf("stdout = %q, want %q", stdout.String(), "name?\nhi bob\n")
+	}
+}
@@ -0,0 +1,263 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/util"
+)
+
+// Object is implemented by class instances of either backend, so natives
+// can read their fields.
+type Object interface {
+	Fields() map[string]Value
+}
+
+// jsonNamespace returns the json namespace. parse turns objects into maps,
+// arrays into lists and numbers into Lox numbers; stringify also accepts
+// instances, writing their fields as an object. The output is charged to
+// the quota as it is written, since shared containers can make it far
+// larger than the value.
+func jsonNamespace() *Namespace {
+	ns := NewNamespace("json")
+	ns.Define("parse", NewNativeFunction("json.parse", 1, func(args ...Value) (Value, error) {
+		text, err := stringArg("json.parse", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return parseJSON(text)
+	}))
+	ns.Define("stringify", newAllocatingNative("json.stringify", VARIADIC, func(quota *Quota, args ...Value) (Value, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("expected 1 or 2 arguments but got %d", len(args))
+		}
+		indent := ""
+		if len(args) == 2 {
+			var err error
+			if indent, err = jsonIndent(args[1]); err != nil {
+				return nil, err
+			}
+		}
+
+		e := jsonEncoder{b: quotaBuilder{quota: quota}, indent: indent, seen: make(map[any]bool)}
+		if err := e.encode(args[0], ""); err != nil {
+			return nil, err
+		}
+		if err := e.b.Err(); err != nil {
+			return nil, err
+		}
+		return e.b.String(), nil
+	}))
+	return ns
+}
+
+// jsonIndent returns the indent stringify was given: a number of spaces,
+// a string, or nil for compact output.
+func jsonIndent(arg Value) (string, error) {
+	switch indent := arg.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return indent, nil
+	case float64:
+		if indent == math.Trunc(indent) && indent >= 0 && indent <= 10 {
+			return strings.Repeat(" ", int(indent)), nil
+		}
+	}
+	return "", errors.New("Argument 2 to json.stringify must be a string or a number of spaces from 0 to 10.")
+}
+
+type jsonEncoder struct {
+	b      quotaBuilder
+	indent string
+	// seen holds the containers being encoded, to detect cycles.
+	seen map[any]bool
+}
+
+func (e *jsonEncoder) encode(value Value, prefix string) error {
+	switch v := value.(type) {
+	case nil:
+		e.b.WriteString("null")
+	case bool:
+		fmt.Fprint(&e.b, v)
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return fmt.Errorf("Can't encode %s as JSON.", Stringify(v))
+		}
+		e.b.WriteString(util.FormatFloat(v, "run"))
+	case string:
+		writeJSONString(&e.b, v)
+	case *LoxList:
+		return e.container(v, '[', ']', prefix, len(v.Elements), func(i int, prefix string) error {
+			return e.encode(v.Elements[i], prefix)
+		})
+	case *LoxMap:
+		keys := v.Keys()
+		for _, key := range keys {
+			if _, ok := key.(string); !ok {
+				return fmt.Errorf("Can't encode map key %s as JSON; keys must be strings.", Stringify(key))
+			}
+		}
+		return e.container(v, '{', '}', prefix, len(keys), func(i int, prefix string) error {
+			value, _ := v.Get(keys[i])
+			return e.member(keys[i].(string), value, prefix)
+		})
+	case Object:
+		fields := v.Fields()
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return e.container(reflect.ValueOf(fields).Pointer(), '{', '}', prefix, len(names), func(i int, prefix string) error {
+			return e.member(names[i], fields[names[i]], prefix)
+		})
+	default:
+		return fmt.Errorf("Can't encode %s as JSON.", Stringify(v))
+	}
+	return nil
+}
+
+// container writes an array or object of n entries, one per line when
+// indenting.
+func (e *jsonEncoder) container(identity any, open, close byte, prefix string, n int, entry func(i int, prefix string) error) error {
+	if e.seen[identity] {
+		return errors.New("Can't encode a cyclic structure as JSON.")
+	}
+	e.seen[identity] = true
+	defer delete(e.seen, identity)
+
+	e.b.WriteByte(open)
+	inner := prefix + e.indent
+	for i := range n {
+		if err := e.b.Err(); err != nil {
+			return err
+		}
+		if i > 0 {
+			e.b.WriteByte(',')
+		}
+		if e.indent != "" {
+			e.b.WriteString("\n" + inner)
+		}
+		if err := entry(i, inner); err != nil {
+			return err
+		}
+	}
+	if e.indent != "" && n > 0 {
+		e.b.WriteString("\n" + prefix)
+	}
+	e.b.WriteByte(close)
+	return nil
+}
+
+func (e *jsonEncoder) member(name string, value Value, prefix string) error {
+	writeJSONString(&e.b, name)
+	e.b.WriteByte(':')
+	if e.indent != "" {
+		e.b.WriteByte(' ')
+	}
+	return e.encode(value, prefix)
+}
+
+func writeJSONString(b *quotaBuilder, s string) {
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
+
+// parseJSON decodes text token by token, so that objects keep their key
+// order. The text is validated first, since the decoder's own syntax errors
+// don't always point at the offending character.
+func parseJSON(text string) (Value, error) {
+	var raw json.RawMessage
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		return nil, jsonError(text, err)
+	}
+	return parseJSONValue(json.NewDecoder(strings.NewReader(text)))
+}
+
+func parseJSONValue(decoder *json.Decoder) (Value, error) {
+	t, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := t.(type) {
+	case json.Delim:
+		if t == '[' {
+			list := NewLoxList(nil)
+			for decoder.More() {
+				element, err := parseJSONValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				list.Elements = append(list.Elements, element)
+			}
+			_, err := decoder.Token()
+			return list, err
+		}
+
+		object := NewLoxMap()
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := parseJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object.Set(key, value)
+		}
+		_, err := decoder.Token()
+		return object, err
+	default:
+		return t, nil
+	}
+}
+
+// jsonError reports a syntax error with the line and column it was found
+// at.
+func jsonError(text string, err error) error {
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return err
+	}
+
+	// The offset is just past the offending character, or the length of
+	// the text if it ended early.
+	offset := int(syntaxErr.Offset) - 1
+	if offset < 0 || offset >= len(text) || syntaxErr.Error() == "unexpected end of JSON input" {
+		offset = len(text)
+	}
+
+	before := text[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+	return fmt.Errorf("Invalid JSON at line %d, column %d: %s.", line, column, syntaxErr)
+}
@@ -0,0 +1,132 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// LoxList is a growable list. Lists are reference values, so every copy of
+// a list sees the same elements.
+type LoxList struct {
+	Elements []Value
+}
+
+func NewLoxList(elements []Value) *LoxList {
+	return &LoxList{Elements: elements}
+}
+
+// Get returns the element at index. The error carries only the message;
+// callers attach the source location.
+func (l *LoxList) Get(index Value) (Value, error) {
+	i, err := listIndex(index, len(l.Elements)-1)
+	if err != nil {
+		return nil, err
+	}
+	return l.Elements[i], nil
+}
+
+func (l *LoxList) Set(index Value, value Value) error {
+	i, err := listIndex(index, len(l.Elements)-1)
+	if err != nil {
+		return err
+	}
+	l.Elements[i] = value
+	return nil
+}
+
+// Method returns the native implementing the list method name, bound to l.
+func (l *LoxList) Method(name string) (*NativeFunction, bool) {
+	switch name {
+	case "len":
+		return NewNativeFunction(name, 0, func(args ...Value) (Value, error) {
+			return float64(len(l.Elements)), nil
+		}), true
+	case "push":
+		return newAllocatingNative(name, 1, func(quota *Quota, args ...Value) (Value, error) {
+			if err := quota.Charge(valueSize); err != nil {
+				return nil, err
+			}
+			l.Elements = append(l.Elements, args[0])
+			return nil, nil
+		}), true
+	case "pop":
+		return NewNativeFunction(name, 0, func(args ...Value) (Value, error) {
+			if len(l.Elements) == 0 {
+				return nil, errors.New("Can't pop from an empty list.")
+			}
+			last := l.Elements[len(l.Elements)-1]
+			l.Elements = l.Elements[:len(l.Elements)-1]
+			return last, nil
+		}), true
+	case "slice":
+		return newAllocatingNative(name, VARIADIC, func(quota *Quota, args ...Value) (Value, error) {
+			if len(args) != 1 && len(args) != 2 {
+				return nil, fmt.Errorf("expected 1 or 2 arguments but got %d", len(args))
+			}
+			start, err := listIndex(args[0], len(l.Elements))
+			if err != nil {
+				return nil, err
+			}
+			end := len(l.Elements)
+			if len(args) == 2 {
+				if end, err = listIndex(args[1], len(l.Elements)); err != nil {
+					return nil, err
+				}
+			}
+			if start > end {
+				return nil, errors.New("List slice start is after its end.")
+			}
+
+			if err := quota.Charge(valueSize * (end - start)); err != nil {
+				return nil, err
+			}
+			elements := make([]Value, end-start)
+			copy(elements, l.Elements[start:end])
+			return NewLoxList(elements), nil
+		}), true
+	case "insert":
+		return newAllocatingNative(name, 2, func(quota *Quota, args ...Value) (Value, error) {
+			i, err := listIndex(args[0], len(l.Elements))
+			if err != nil {
+				return nil, err
+			}
+			if err := quota.Charge(valueSize); err != nil {
+				return nil, err
+			}
+			l.Elements = append(l.Elements, nil)
+			copy(l.Elements[i+1:], l.Elements[i:])
+			l.Elements[i] = args[1]
+			return nil, nil
+		}), true
+	case "remove":
+		return NewNativeFunction(name, 1, func(args ...Value) (Value, error) {
+			i, err := listIndex(args[0], len(l.Elements)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed := l.Elements[i]
+			l.Elements = append(l.Elements[:i], l.Elements[i+1:]...)
+			return removed, nil
+		}), true
+	}
+	return nil, false
+}
+
+func (l *LoxList) String() string {
+	var b quotaBuilder
+	writeValue(&b, l, map[any]bool{})
+	return b.String()
+}
+
+// listIndex checks that index is an integer in [0, max].
+func listIndex(index Value, max int) (int, error) {
+	num, ok := index.(float64)
+	if !ok || num != math.Trunc(num) {
+		return 0, errors.New("List index must be an integer.")
+	}
+	if num < 0 || num > float64(max) {
+		return 0, errors.New("List index out of range.")
+	}
+	return int(num), nil
+}
@@ -0,0 +1,133 @@
+package interpreter
+
+import (
+	"errors"
+	"math"
+	"slices"
+)
+
+// LoxMap is a hash map from strings, numbers, booleans and nil to values.
+// Iteration follows insertion order. Like lists, maps are reference values.
+//
+// Number keys hash by value, so 1 and 1.0 are the same key and -0 is stored
+// as 0. NaN is not equal to itself and is rejected as a key.
+type LoxMap struct {
+	keys   []Value
+	values map[Value]Value
+}
+
+func NewLoxMap() *LoxMap {
+	return &LoxMap{values: make(map[Value]Value)}
+}
+
+func (m *LoxMap) Len() int {
+	return len(m.keys)
+}
+
+// Keys returns the keys in insertion order.
+func (m *LoxMap) Keys() []Value {
+	return slices.Clone(m.keys)
+}
+
+// Get returns the value for key, or nil when key is missing.
+func (m *LoxMap) Get(key Value) (Value, error) {
+	key, err := mapKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return m.values[key], nil
+}
+
+func (m *LoxMap) Set(key Value, value Value) error {
+	key, err := mapKey(key)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+	return nil
+}
+
+func (m *LoxMap) Has(key Value) (bool, error) {
+	key, err := mapKey(key)
+	if err != nil {
+		return false, err
+	}
+	_, ok := m.values[key]
+	return ok, nil
+}
+
+// Delete removes key and reports whether it was present.
+func (m *LoxMap) Delete(key Value) (bool, error) {
+	key, err := mapKey(key)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := m.values[key]; !ok {
+		return false, nil
+	}
+	delete(m.values, key)
+	m.keys = slices.DeleteFunc(m.keys, func(k Value) bool { return k == key })
+	return true, nil
+}
+
+// Method returns the native implementing the map method name, bound to m.
+func (m *LoxMap) Method(name string) (*NativeFunction, bool) {
+	switch name {
+	case "len":
+		return NewNativeFunction(name, 0, func(args ...Value) (Value, error) {
+			return float64(m.Len()), nil
+		}), true
+	case "keys":
+		return newAllocatingNative(name, 0, func(quota *Quota, args ...Value) (Value, error) {
+			if err := quota.Charge(valueSize * m.Len()); err != nil {
+				return nil, err
+			}
+			return NewLoxList(m.Keys()), nil
+		}), true
+	case "values":
+		return newAllocatingNative(name, 0, func(quota *Quota, args ...Value) (Value, error) {
+			if err := quota.Charge(valueSize * m.Len()); err != nil {
+				return nil, err
+			}
+			values := make([]Value, len(m.keys))
+			for i, key := range m.keys {
+				values[i] = m.values[key]
+			}
+			return NewLoxList(values), nil
+		}), true
+	case "has":
+		return NewNativeFunction(name, 1, func(args ...Value) (Value, error) {
+			return m.Has(args[0])
+		}), true
+	case "delete":
+		return NewNativeFunction(name, 1, func(args ...Value) (Value, error) {
+			return m.Delete(args[0])
+		}), true
+	}
+	return nil, false
+}
+
+func (m *LoxMap) String() string {
+	var b quotaBuilder
+	writeValue(&b, m, map[any]bool{})
+	return b.String()
+}
+
+func mapKey(key Value) (Value, error) {
+	switch k := key.(type) {
+	case float64:
+		if math.IsNaN(k) {
+			return nil, errors.New("Map key can't be NaN.")
+		}
+		if k == 0 {
+			return 0.0, nil
+		}
+		return k, nil
+	case nil, bool, string:
+		return k, nil
+	}
+	return nil, errors.New("Map key must be a string, number, boolean or nil.")
+}
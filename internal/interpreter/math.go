@@ -0,0 +1,54 @@
+package interpreter
+
+import "math"
+
+// mathNamespace returns the math namespace. Its functions take numbers
+// only; any other argument is a runtime error.
+func mathNamespace() *Namespace {
+	ns := NewNamespace("math")
+	ns.Define("pi", math.Pi)
+	ns.Define("inf", math.Inf(1))
+	ns.Define("nan", math.NaN())
+
+	functions := []struct {
+		name string
+		fn   any
+	}{
+		{"sqrt", math.Sqrt},
+		{"pow", math.Pow},
+		{"floor", math.Floor},
+		{"ceil", math.Ceil},
+		{"abs", math.Abs},
+		{"min", func(x float64, rest ...float64) float64 {
+			for _, y := range rest {
+				x = math.Min(x, y)
+			}
+			return x
+		}},
+		{"max", func(x float64, rest ...float64) float64 {
+			for _, y := range rest {
+				x = math.Max(x, y)
+			}
+			return x
+		}},
+		{"sin", math.Sin},
+		{"cos", math.Cos},
+		{"tan", math.Tan},
+		{"asin", math.Asin},
+		{"acos", math.Acos},
+		{"atan", math.Atan},
+		{"atan2", math.Atan2},
+		{"log", math.Log},
+		{"exp", math.Exp},
+		{"isNaN", math.IsNaN},
+		{"isInf", func(x float64) bool { return math.IsInf(x, 0) }},
+	}
+	for _, function := range functions {
+		native, err := WrapFunc("math."+function.name, function.fn)
+		if err != nil {
+			panic(err)
+		}
+		ns.Define(function.name, native)
+	}
+	return ns
+}
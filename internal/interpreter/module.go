@@ -0,0 +1,258 @@
+package interpreter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
+)
+
+// module is a Lox source file with its own global scope. The script being
+// run is a module too, though nothing can import it.
+type module struct {
+	// path is the file as found from the importing file, and key its
+	// absolute path, which identifies the module in the cache. Both are
+	// empty for a script that wasn't read from a file.
+	path    string
+	key     string
+	script  bool
+	globals *Environment
+	exports map[string]bool
+}
+
+func newModule(path string, builtins *Environment) *module {
+	return &module{
+		path:    path,
+		key:     absPath(path),
+		globals: newGlobals(builtins),
+		exports: make(map[string]bool),
+	}
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// dir is the directory that imports in the module are relative to.
+func (m *module) dir() string {
+	if m == nil || m.path == "" {
+		return ""
+	}
+	return filepath.Dir(m.path)
+}
+
+// file is the path errors raised in the module are reported with. It is
+// empty for the script, whose source the error renderer already has.
+func (m *module) file() string {
+	if m == nil || m.script {
+		return ""
+	}
+	return m.path
+}
+
+func (m *module) get(name token.Token) (any, error) {
+	if !m.exports[name.Lexeme] {
+		return nil, newRuntimeError(name, fmt.Sprintf("module %s has no export %s", m.path, name.Lexeme))
+	}
+	return m.globals.values[name.Lexeme], nil
+}
+
+func (m *module) String() string {
+	return fmt.Sprintf("<module %s>", m.path)
+}
+
+// modules caches every module an interpreter has loaded, so each runs only
+// once. It is shared by every copy of an Interpreter.
+type modules struct {
+	loaded map[string]*module
+	// loading is the chain of imports being run, used to report cycles.
+	loading []*module
+}
+
+func newModules() *modules {
+	return &modules{loaded: make(map[string]*module)}
+}
+
+// LOX_PATH_VARIABLE names the environment variable listing directories to
+// search for modules not found next to the importing file.
+const LOX_PATH_VARIABLE = "LOX_PATH"
+
+// SetScriptPath records the file the program was read from, so that its
+// imports are found relative to it.
+func (i *Interpreter) SetScriptPath(path string) {
+	i.module.path, i.module.key = path, absPath(path)
+	i.modules.loading = []*module{i.module}
+}
+
+func (i *Interpreter) VisitImportStmt(s *ast.ImportStmt) (any, error) {
+	m, err := i.importModule(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Names == nil {
+		if err := i.quota.Allocate(s.Alias, valueSize); err != nil {
+			return nil, err
+		}
+		i.environment.define(s.Alias.Lexeme, m)
+		return nil, nil
+	}
+
+	for _, name := range s.Names {
+		value, err := m.get(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.quota.Allocate(name, valueSize); err != nil {
+			return nil, err
+		}
+		i.environment.define(name.Lexeme, value)
+	}
+	return nil, nil
+}
+
+func (i *Interpreter) VisitExportStmt(s *ast.ExportStmt) (any, error) {
+	if _, err := s.Declaration.Accept(i); err != nil {
+		return nil, err
+	}
+
+	switch declaration := s.Declaration.(type) {
+	case *ast.VarStmt:
+		i.module.exports[declaration.Name.Lexeme] = true
+	case *ast.FunctionStmt:
+		i.module.exports[declaration.Name.Lexeme] = true
+	case *ast.ClassStmt:
+		i.module.exports[declaration.Name.Lexeme] = true
+	}
+	return nil, nil
+}
+
+// importModule returns the module path names, running it first unless it
+// has already been loaded.
+func (i *Interpreter) importModule(path token.Token) (*module, error) {
+	name, _ := path.Literal.(string)
+	file, ok := i.findModule(name)
+	if !ok {
+		return nil, newRuntimeError(path, fmt.Sprintf("Can't find module '%s'.", name))
+	}
+
+	m := newModule(file, i.builtins)
+	if loaded, ok := i.modules.loaded[m.key]; ok {
+		return loaded, nil
+	}
+	for k, loading := range i.modules.loading {
+		if loading.key == m.key {
+			cycle := make([]string, 0, len(i.modules.loading)-k+1)
+			for _, importer := range i.modules.loading[k:] {
+				cycle = append(cycle, importer.path)
+			}
+			cycle = append(cycle, m.path)
+			return nil, newRuntimeError(path, fmt.Sprintf("Import cycle: %s.", strings.Join(cycle, " -> ")))
+		}
+	}
+
+	statements, err := i.parseModule(file)
+	if err != nil {
+		return nil, newRuntimeError(path, fmt.Sprintf("Can't load module '%s': %s", name, loadFailure(err)))
+	}
+
+	i.modules.loading = append(i.modules.loading, m)
+	err = i.runModule(m, statements)
+	i.modules.loading = i.modules.loading[:len(i.modules.loading)-1]
+	if err != nil {
+		return nil, err
+	}
+
+	i.modules.loaded[m.key] = m
+	return m, nil
+}
+
+// findModule looks for name relative to the current module's directory,
+// then in each directory listed in LOX_PATH. Names must be relative paths
+// that stay inside those directories, so a script can't read other files
+// by importing them.
+func (i *Interpreter) findModule(name string) (string, bool) {
+	if !filepath.IsLocal(name) {
+		return "", false
+	}
+
+	dirs := []string{i.module.dir()}
+	for _, dir := range filepath.SplitList(os.Getenv(LOX_PATH_VARIABLE)) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, dir := range dirs {
+		if file := filepath.Join(dir, name); isFile(file) {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// parseModule reads, parses and resolves a module's source. Only the first
+// error is reported.
+func (i *Interpreter) parseModule(file string) ([]ast.Stmt, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := scanner.NewScanner(string(source))
+	tokens, err := sc.ScanTokens()
+	if err != nil {
+		return nil, err
+	}
+	statements, parseErrors := parser.NewParser(tokens).Parse()
+	if len(parseErrors) > 0 {
+		return nil, parseErrors[0]
+	}
+	resolver := NewResolver(*i)
+	if _, err := resolver.Resolve(statements); err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
+
+// loadFailure describes why a module couldn't be parsed without quoting
+// its source, which need not be Lox at all.
+func loadFailure(err error) string {
+	if spanned, ok := err.(interface{ Span() token.Span }); ok {
+		return fmt.Sprintf("syntax error on line %d.", spanned.Span().Line)
+	}
+	return "can't read it."
+}
+
+// runModule runs a module's statements in its own global scope. Runtime
+// errors raised by the module's own top-level code are marked with its
+// path.
+func (i *Interpreter) runModule(m *module, statements []ast.Stmt) error {
+	moduleInterpreter := *i
+	moduleInterpreter.environment = m.globals
+	moduleInterpreter.globals = m.globals
+	moduleInterpreter.module = m
+
+	for _, statement := range statements {
+		if _, err := statement.Accept(&moduleInterpreter); err != nil {
+			if runtimeErr, ok := err.(RuntimeError); ok && runtimeErr.Trace == nil && runtimeErr.File == "" {
+				runtimeErr.File = m.path
+				return runtimeErr
+			}
+			return err
+		}
+	}
+	return nil
+}
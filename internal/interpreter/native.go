@@ -1,19 +1,437 @@
 package interpreter
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
 )
 
-type ClockFunction struct{}
+// Value is any Lox value: nil, bool, float64, string, or one of the
+// interpreter's callable and object types.
+type Value = any
+
+// NativeFunc is the signature host code implements to expose a function to
+// Lox. Arguments arrive already arity-checked.
+type NativeFunc func(args ...Value) (Value, error)
+
+// VARIADIC is the arity of natives that accept a varying number of
+// arguments. They validate the count themselves.
+const VARIADIC = -1
+
+// allocatingFunc is the signature of natives that allocate memory as the
+// program asks, such as list.push. They charge it to quota, which is nil
+// when there is no limit.
+type allocatingFunc func(quota *Quota, args ...Value) (Value, error)
+
+// blockingFunc is the signature of natives that wait on something outside
+// the program, such as readLine. They return ctx's error once it is done.
+type blockingFunc func(ctx context.Context, args ...Value) (Value, error)
+
+type NativeFunction struct {
+	name     string
+	arity    int
+	fn       allocatingFunc
+	blocking blockingFunc
+}
+
+func NewNativeFunction(name string, arity int, fn NativeFunc) *NativeFunction {
+	return newAllocatingNative(name, arity, func(quota *Quota, args ...Value) (Value, error) {
+		return fn(args...)
+	})
+}
+
+func newAllocatingNative(name string, arity int, fn allocatingFunc) *NativeFunction {
+	return &NativeFunction{
+		name:  name,
+		arity: arity,
+		fn:    fn,
+	}
+}
+
+func newBlockingNative(name string, arity int, fn blockingFunc) *NativeFunction {
+	return &NativeFunction{
+		name:     name,
+		arity:    arity,
+		blocking: fn,
+	}
+}
+
+func (n *NativeFunction) Call(interpreter Interpreter, arguments []any) (any, error) {
+	return n.invoke(interpreter.quota, interpreter.budget, arguments)
+}
+
+// Invoke runs the native without an interpreter, for other backends. A
+// native waiting for input stops with a BudgetError once budget's context
+// is done; the error has no span, so the caller should locate it.
+func (n *NativeFunction) Invoke(budget *Budget, arguments []any) (any, error) {
+	return n.invoke(nil, budget, arguments)
+}
+
+func (n *NativeFunction) invoke(quota *Quota, budget *Budget, arguments []any) (any, error) {
+	if n.blocking == nil {
+		return n.fn(quota, arguments...)
+	}
+
+	ctx := budget.Context()
+	value, err := n.blocking(ctx, arguments...)
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return nil, NewBudgetError(token.Span{}, ctx.Err())
+	}
+	return value, err
+}
+
+func (n *NativeFunction) Arity() int {
+	return n.arity
+}
+
+func (n *NativeFunction) Name() string {
+	return n.name
+}
+
+func (n *NativeFunction) String() string {
+	return fmt.Sprintf("<native fn %s>", n.name)
+}
+
+// Namespace groups natives and constants under one global, such as math,
+// so that they don't take up global names of their own.
+type Namespace struct {
+	name    string
+	members map[string]Value
+}
+
+func NewNamespace(name string) *Namespace {
+	return &Namespace{name: name, members: make(map[string]Value)}
+}
+
+func (n *Namespace) Define(name string, value Value) {
+	n.members[name] = value
+}
+
+// Member returns the value of name in the namespace.
+func (n *Namespace) Member(name string) (Value, bool) {
+	value, ok := n.members[name]
+	return value, ok
+}
+
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+func (n *Namespace) String() string {
+	return fmt.Sprintf("<namespace %s>", n.name)
+}
+
+// NativeRegistry collects natives and namespaces so the same set can be
+// installed into several interpreters.
+type NativeRegistry struct {
+	natives    []*NativeFunction
+	namespaces []*Namespace
+}
+
+func NewNativeRegistry() *NativeRegistry {
+	return &NativeRegistry{}
+}
+
+// Builtins returns the natives every interpreter starts with.
+func Builtins() *NativeRegistry {
+	registry := NewNativeRegistry()
+	registry.Register("clock", 0, func(args ...Value) (Value, error) {
+		return float64(time.Now().UnixNano()) / 1e9, nil
+	})
+	registerConversions(registry)
+	registry.RegisterNamespace(mathNamespace())
+	registry.RegisterNamespace(jsonNamespace())
+	return registry
+}
 
-func (c *ClockFunction) Call(interpreter Interpreter, arguments []any) (any, error) {
-	return float64(time.Now().UnixNano()) / 1e9, nil
+func (r *NativeRegistry) Register(name string, arity int, fn NativeFunc) {
+	r.natives = append(r.natives, NewNativeFunction(name, arity, fn))
 }
 
-func (c *ClockFunction) Arity() int {
-	return 0
+func (r *NativeRegistry) registerAllocating(name string, arity int, fn allocatingFunc) {
+	r.natives = append(r.natives, newAllocatingNative(name, arity, fn))
 }
 
-func (c *ClockFunction) String() string {
-	return "<native fn clock>"
+func (r *NativeRegistry) registerBlocking(name string, arity int, fn blockingFunc) {
+	r.natives = append(r.natives, newBlockingNative(name, arity, fn))
+}
+
+// RegisterFunc exposes a plain Go function such as
+// func(a float64, b string) bool. See WrapFunc for the supported shapes.
+func (r *NativeRegistry) RegisterFunc(name string, fn any) error {
+	native, err := WrapFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	r.natives = append(r.natives, native)
+	return nil
+}
+
+// RegisterNamespace installs ns as a global under its name.
+func (r *NativeRegistry) RegisterNamespace(ns *Namespace) {
+	r.namespaces = append(r.namespaces, ns)
+}
+
+func (r *NativeRegistry) Natives() []*NativeFunction {
+	return r.natives
+}
+
+func (r *NativeRegistry) Namespaces() []*Namespace {
+	return r.namespaces
+}
+
+var (
+	valueType = reflect.TypeOf((*Value)(nil)).Elem()
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// WrapFunc turns a Go function into a native using reflection. Parameters
+// may be numeric, string, bool or Value, and the function may be variadic.
+// It may return nothing, a value, an error, or a value and an error.
+func WrapFunc(name string, fn any) (*NativeFunction, error) {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	if fnType.Kind() != reflect.Func {
+		return nil, fmt.Errorf("native %s: expected a function but got %T", name, fn)
+	}
+
+	for i := range fnType.NumIn() {
+		paramType := fnType.In(i)
+		if fnType.IsVariadic() && i == fnType.NumIn()-1 {
+			paramType = paramType.Elem()
+		}
+		if !isConvertibleParam(paramType) {
+			return nil, fmt.Errorf("native %s: unsupported parameter type %s", name, paramType)
+		}
+	}
+
+	switch fnType.NumOut() {
+	case 0:
+	case 1:
+	case 2:
+		if fnType.Out(1) != errorType {
+			return nil, fmt.Errorf("native %s: second result must be an error", name)
+		}
+	default:
+		return nil, fmt.Errorf("native %s: too many results", name)
+	}
+
+	required := fnType.NumIn()
+	arity := required
+	if fnType.IsVariadic() {
+		required--
+		arity = VARIADIC
+	}
+
+	call := func(args ...Value) (Value, error) {
+		if len(args) < required {
+			return nil, fmt.Errorf("expected at least %d arguments but got %d", required, len(args))
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			paramType := paramTypeAt(fnType, i)
+			converted, err := toGo(arg, paramType)
+			if err != nil {
+				return nil, fmt.Errorf("Argument %d to %s must be %s.", i+1, name, err)
+			}
+			in[i] = converted
+		}
+
+		return fromResults(fnValue.Call(in))
+	}
+
+	return NewNativeFunction(name, arity, call), nil
+}
+
+func paramTypeAt(fnType reflect.Type, i int) reflect.Type {
+	if fnType.IsVariadic() && i >= fnType.NumIn()-1 {
+		return fnType.In(fnType.NumIn() - 1).Elem()
+	}
+	return fnType.In(i)
+}
+
+func isConvertibleParam(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.String, reflect.Bool:
+		return true
+	case reflect.Interface:
+		return t == valueType
+	}
+	return false
+}
+
+// toGo converts a Lox argument to the Go parameter type t. The error
+// describes the expected kind, to complete "Argument n to f must be ...".
+func toGo(arg Value, t reflect.Type) (reflect.Value, error) {
+	switch t.Kind() {
+	case reflect.Interface:
+		if arg == nil {
+			return reflect.Zero(t), nil
+		}
+		return reflect.ValueOf(arg), nil
+	case reflect.String:
+		s, ok := arg.(string)
+		if !ok {
+			return reflect.Value{}, errors.New("a string")
+		}
+		return reflect.ValueOf(s).Convert(t), nil
+	case reflect.Bool:
+		b, ok := arg.(bool)
+		if !ok {
+			return reflect.Value{}, errors.New("a boolean")
+		}
+		return reflect.ValueOf(b).Convert(t), nil
+	case reflect.Float32, reflect.Float64:
+		num, ok := arg.(float64)
+		if !ok {
+			return reflect.Value{}, errors.New("a number")
+		}
+		return reflect.ValueOf(num).Convert(t), nil
+	default:
+		num, ok := arg.(float64)
+		if !ok || num != math.Trunc(num) {
+			return reflect.Value{}, errors.New("an integer")
+		}
+		if t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64 && num < 0 {
+			return reflect.Value{}, errors.New("a non-negative integer")
+		}
+		return reflect.ValueOf(num).Convert(t), nil
+	}
+}
+
+func fromResults(results []reflect.Value) (Value, error) {
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	last := results[len(results)-1]
+	if last.Type() == errorType {
+		if !last.IsNil() {
+			return nil, last.Interface().(error)
+		}
+		if len(results) == 1 {
+			return nil, nil
+		}
+	}
+
+	return FromGo(results[0].Interface())
+}
+
+// FromGo converts a Go value to a Lox value. Go numbers of any type become
+// float64, slices and arrays become lists and maps become maps, with their
+// keys in sorted order; values that already belong to Lox pass through
+// unchanged.
+func FromGo(value any) (Value, error) {
+	return fromGo(value, make(map[goReference]Value))
+}
+
+// goReference identifies a Go slice or map, so that one referred to twice,
+// or from within itself, becomes a single Lox list or map.
+type goReference struct {
+	kind    reflect.Kind
+	pointer uintptr
+	len     int
+}
+
+func fromGo(value any, seen map[goReference]Value) (Value, error) {
+	switch v := value.(type) {
+	case nil, bool, float64, string, LoxCallable:
+		return v, nil
+	case NativeFunc:
+		return NewNativeFunction("native", VARIADIC, v), nil
+	case func(args ...Value) (Value, error):
+		return NewNativeFunction("native", VARIADIC, v), nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Slice, reflect.Array:
+		return listFromGo(rv, seen)
+	case reflect.Map:
+		return mapFromGo(rv, seen)
+	}
+
+	t := rv.Type()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.PkgPath() == reflect.TypeOf(Interpreter{}).PkgPath() {
+		return value, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to a Lox value", value)
+}
+
+func listFromGo(rv reflect.Value, seen map[goReference]Value) (Value, error) {
+	// Empty slices may share a pointer without being the same slice.
+	var ref goReference
+	if rv.Kind() == reflect.Slice && rv.Len() > 0 {
+		ref = goReference{kind: reflect.Slice, pointer: rv.Pointer(), len: rv.Len()}
+		if list, ok := seen[ref]; ok {
+			return list, nil
+		}
+	}
+
+	list := NewLoxList(make([]Value, rv.Len()))
+	if ref.pointer != 0 {
+		seen[ref] = list
+	}
+	for i := range list.Elements {
+		element, err := fromGo(rv.Index(i).Interface(), seen)
+		if err != nil {
+			return nil, err
+		}
+		list.Elements[i] = element
+	}
+	return list, nil
+}
+
+func mapFromGo(rv reflect.Value, seen map[goReference]Value) (Value, error) {
+	ref := goReference{kind: reflect.Map, pointer: rv.Pointer()}
+	if m, ok := seen[ref]; ok && ref.pointer != 0 {
+		return m, nil
+	}
+
+	m := NewLoxMap()
+	if ref.pointer != 0 {
+		seen[ref] = m
+	}
+	keys := rv.MapKeys()
+	slices.SortFunc(keys, func(a, b reflect.Value) int {
+		return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+	})
+	for _, key := range keys {
+		k, err := fromGo(key.Interface(), seen)
+		if err != nil {
+			return nil, err
+		}
+		v, err := fromGo(rv.MapIndex(key).Interface(), seen)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.Set(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
 }
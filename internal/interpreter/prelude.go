@@ -0,0 +1,82 @@
+package interpreter
+
+import (
+	"github.com/codecrafters-io/interpreter-starter-go/internal/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
+)
+
+// Prelude is Lox source that every interpreter runs before user code.
+// Runtime errors reach catch clauses as instances of its Error class.
+const Prelude = `
+class Error {
+  init(message) {
+    this.message = message;
+    this.line = nil;
+  }
+}
+`
+
+// ParsePrelude parses Prelude. It panics if the prelude is invalid, since
+// that is a bug in the interpreter rather than in user code.
+func ParsePrelude() []ast.Stmt {
+	sc := scanner.NewScanner(Prelude)
+	tokens, err := sc.ScanTokens()
+	if err != nil {
+		panic(err)
+	}
+	statements, parseErrors := parser.NewParser(tokens).Parse()
+	if len(parseErrors) > 0 {
+		panic(parseErrors[0])
+	}
+	return statements
+}
+
+func (i *Interpreter) runPrelude() {
+	statements := ParsePrelude()
+	resolver := NewResolver(*i)
+	if _, err := resolver.Resolve(statements); err != nil {
+		panic(err)
+	}
+	for _, stmt := range statements {
+		if _, err := stmt.Accept(i); err != nil {
+			panic(err)
+		}
+	}
+
+	errorClass, _ := i.builtins.values["Error"].(class)
+	i.errorClass = errorClass
+}
+
+// newThrow wraps a value thrown by a throw statement in a RuntimeError, so
+// that it unwinds like any other runtime error. An Error instance without
+// a line gets the line of the throw.
+func newThrow(keyword token.Token, value any) RuntimeError {
+	message := Stringify(value)
+	if inst, ok := value.(instance); ok {
+		if text, ok := inst.fields["message"]; ok {
+			message = Stringify(text)
+		}
+		if line, ok := inst.fields["line"]; ok && line == nil {
+			inst.fields["line"] = float64(keyword.Line)
+		}
+	}
+
+	err := newRuntimeError(keyword, message)
+	err.Thrown = true
+	err.Value = value
+	return err
+}
+
+// errorValue is the value a catch clause binds for err.
+func (i *Interpreter) errorValue(err RuntimeError) any {
+	if err.Thrown {
+		return err.Value
+	}
+
+	inst := newInstance(i.errorClass)
+	inst.fields["message"] = err.Message
+	inst.fields["line"] = float64(err.Line)
+	return inst
+}
@@ -0,0 +1,110 @@
+package interpreter
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
+)
+
+// Rough sizes, in bytes, that Quota charges for each kind of allocation.
+// They only need to grow with real memory use, and being fixed keeps the
+// point where a quota runs out the same from run to run.
+const (
+	valueSize       = 16
+	environmentSize = 64
+	instanceSize    = 64
+	closureSize     = 64
+)
+
+// Quota limits how many bytes a program may allocate for strings,
+// instances and their fields, environments, closures, and list and map
+// literals. It counts every allocation rather than live memory, so a
+// program can't free up quota. It is shared by every copy of an
+// Interpreter.
+type Quota struct {
+	maxBytes int
+	used     int
+}
+
+func NewQuota() *Quota {
+	return &Quota{}
+}
+
+// SetMaxBytes limits how many more bytes may be allocated. Zero means no
+// limit.
+func (q *Quota) SetMaxBytes(bytes int) {
+	q.maxBytes = bytes
+	q.used = 0
+}
+
+// Used returns how many bytes have been allocated since the limit was set.
+func (q *Quota) Used() int {
+	return q.used
+}
+
+var errQuotaExceeded = errors.New("Memory quota exceeded.")
+
+// Allocate charges bytes allocated at t. Past the limit it charges nothing
+// and returns a RuntimeError, which Lox code may catch; every further
+// allocation that doesn't fit fails the same way.
+func (q *Quota) Allocate(t token.Token, bytes int) error {
+	if err := q.Charge(bytes); err != nil {
+		return newRuntimeError(t, err.Error())
+	}
+	return nil
+}
+
+// Charge is Allocate for natives, which don't know where they were called
+// from. The call site turns its error into a RuntimeError.
+func (q *Quota) Charge(bytes int) error {
+	if q == nil {
+		return nil
+	}
+	if q.maxBytes > 0 && q.used+bytes > q.maxBytes {
+		return errQuotaExceeded
+	}
+	q.used += bytes
+	return nil
+}
+
+// quotaBuilder is a strings.Builder that charges quota for bytes before
+// writing them, so that a native building a long string fails as soon as
+// the quota runs out rather than after building all of it. Once a write
+// fails, later writes do nothing and Err reports the failure.
+type quotaBuilder struct {
+	b     strings.Builder
+	quota *Quota
+	err   error
+}
+
+func (w *quotaBuilder) WriteString(s string) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.err = w.quota.Charge(len(s)); w.err != nil {
+		return 0, w.err
+	}
+	return w.b.WriteString(s)
+}
+
+func (w *quotaBuilder) Write(p []byte) (int, error) {
+	return w.WriteString(string(p))
+}
+
+func (w *quotaBuilder) WriteByte(c byte) error {
+	_, err := w.WriteString(string([]byte{c}))
+	return err
+}
+
+func (w *quotaBuilder) WriteRune(r rune) (int, error) {
+	return w.WriteString(string(r))
+}
+
+func (w *quotaBuilder) Err() error {
+	return w.err
+}
+
+func (w *quotaBuilder) String() string {
+	return w.b.String()
+}
@@ -24,17 +24,45 @@ const (
 	SUBCLASS
 )
 
+// ResolveError is a static error found while resolving variable scopes,
+// before any code runs.
+type ResolveError struct {
+	Token   token.Token
+	Message string
+}
+
+func newResolveError(t token.Token, message string) ResolveError {
+	return ResolveError{Token: t, Message: message}
+}
+
+func (e ResolveError) Error() string {
+	return fmt.Sprintf("[line %d] Error at '%s': %s", e.Token.Line, e.Token.Lexeme, e.Message)
+}
+
+func (e ResolveError) Span() token.Span {
+	return e.Token.Span()
+}
+
+// variable is a local variable known to the resolver. Slots are numbered
+// per scope in declaration order, which is the order the interpreter
+// defines them in at runtime.
+type variable struct {
+	slot    int
+	defined bool
+}
+
 type Resolver struct {
 	interpreter     Interpreter
-	scopes          []map[string]bool
+	scopes          []map[string]variable
 	currentFunction functionType
 	currentClass    classType
+	loopDepth       int
 }
 
 func NewResolver(interpreter Interpreter) Resolver {
 	return Resolver{
 		interpreter:     interpreter,
-		scopes:          []map[string]bool{},
+		scopes:          []map[string]variable{},
 		currentFunction: NONEFUNCTION,
 		currentClass:    NONECLASS,
 	}
@@ -53,12 +81,12 @@ func (r *Resolver) VisitExpressionStmt(stmt *ast.ExpressionStmt) (any, error) {
 func (r *Resolver) VisitFunctionStmt(stmt *ast.FunctionStmt) (any, error) {
 	if len(r.scopes) != 0 {
 		if _, exists := r.scopes[len(r.scopes)-1][stmt.Name.Lexeme]; exists {
-			return nil, fmt.Errorf("[Line %d] Error at '%v': Already a function with this name in this scope", stmt.Name.Line, stmt.Name.Lexeme)
+			return nil, newResolveError(stmt.Name, "Already a function with this name in this scope")
 		}
 	}
 	r.declare(stmt.Name)
 	r.define(stmt.Name)
-	return r.resolveFunction(*stmt, FUNCTION)
+	return r.resolveFunction(stmt.Parameters, stmt.Body, FUNCTION)
 }
 
 func (r *Resolver) VisitIfStmt(stmt *ast.IfStmt) (any, error) {
@@ -85,12 +113,12 @@ func (r *Resolver) VisitPrintStmt(stmt *ast.PrintStmt) (any, error) {
 
 func (r *Resolver) VisitReturnStmt(stmt *ast.ReturnStmt) (any, error) {
 	if r.currentFunction == NONEFUNCTION {
-		return nil, fmt.Errorf("[Line %d] Can't return from top-level code", stmt.Keyword.Line)
+		return nil, newResolveError(stmt.Keyword, "Can't return from top-level code")
 	}
 
 	if stmt.Value != nil {
 		if r.currentFunction == INITIALIZER {
-			return nil, fmt.Errorf("[Line %d] Can't return a value from initializer", stmt.Keyword.Line)
+			return nil, newResolveError(stmt.Keyword, "Can't return a value from initializer")
 		}
 		return r.resolveExpr(stmt.Value)
 	}
@@ -101,7 +129,7 @@ func (r *Resolver) VisitReturnStmt(stmt *ast.ReturnStmt) (any, error) {
 func (r *Resolver) VisitVarStmt(stmt *ast.VarStmt) (any, error) {
 	if len(r.scopes) != 0 {
 		if _, exists := r.scopes[len(r.scopes)-1][stmt.Name.Lexeme]; exists {
-			return nil, fmt.Errorf("[Line %d] Error at '%v': Already a variable with this name in this scope", stmt.Name.Line, stmt.Name.Lexeme)
+			return nil, newResolveError(stmt.Name, "Already a variable with this name in this scope")
 		}
 	}
 
@@ -120,7 +148,80 @@ func (r *Resolver) VisitWhileStmt(stmt *ast.WhileStmt) (any, error) {
 		return nil, err
 	}
 
-	return r.resolveStmt(stmt.Body)
+	r.loopDepth++
+	defer func() {
+		r.loopDepth--
+	}()
+	if _, err := r.resolveStmt(stmt.Body); err != nil {
+		return nil, err
+	}
+
+	if stmt.Increment != nil {
+		return r.resolveExpr(stmt.Increment)
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitThrowStmt(stmt *ast.ThrowStmt) (any, error) {
+	return r.resolveExpr(stmt.Value)
+}
+
+func (r *Resolver) VisitTryStmt(stmt *ast.TryStmt) (any, error) {
+	if _, err := r.resolveStmt(stmt.Body); err != nil {
+		return nil, err
+	}
+
+	if stmt.Catch != nil {
+		r.beginScope()
+		r.declare(stmt.CatchName)
+		r.define(stmt.CatchName)
+		_, err := r.resolveStmt(stmt.Catch)
+		r.endScope()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if stmt.Finally != nil {
+		return r.resolveStmt(stmt.Finally)
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitImportStmt(stmt *ast.ImportStmt) (any, error) {
+	if len(r.scopes) != 0 {
+		return nil, newResolveError(stmt.Keyword, "Can only import at the top level of a file")
+	}
+
+	seen := make(map[string]bool, len(stmt.Names))
+	for _, name := range stmt.Names {
+		if seen[name.Lexeme] {
+			return nil, newResolveError(name, "Already imported this name")
+		}
+		seen[name.Lexeme] = true
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitExportStmt(stmt *ast.ExportStmt) (any, error) {
+	if len(r.scopes) != 0 {
+		return nil, newResolveError(stmt.Keyword, "Can only export top-level declarations")
+	}
+	return r.resolveStmt(stmt.Declaration)
+}
+
+func (r *Resolver) VisitBreakStmt(stmt *ast.BreakStmt) (any, error) {
+	if r.loopDepth == 0 {
+		return nil, newResolveError(stmt.Keyword, "Can't use 'break' outside of a loop")
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitContinueStmt(stmt *ast.ContinueStmt) (any, error) {
+	if r.loopDepth == 0 {
+		return nil, newResolveError(stmt.Keyword, "Can't use 'continue' outside of a loop")
+	}
+	return nil, nil
 }
 
 func (r *Resolver) VisitClassStmt(stmt *ast.ClassStmt) (any, error) {
@@ -135,32 +236,29 @@ func (r *Resolver) VisitClassStmt(stmt *ast.ClassStmt) (any, error) {
 
 	if stmt.Superclass != nil &&
 		stmt.Name.Lexeme == stmt.Superclass.Name.Lexeme {
-		return nil, fmt.Errorf("line %d: a class can't inherit from itself", stmt.Superclass.Name.Line)
+		return nil, newResolveError(stmt.Superclass.Name, "A class can't inherit from itself")
 	}
 	if stmt.Superclass != nil {
 		r.currentClass = SUBCLASS
 		r.resolveExpr(stmt.Superclass)
 		r.beginScope()
-		r.scopes[len(r.scopes)-1]["super"] = true
+		defer r.endScope()
+		r.defineName("super")
 	}
 
 	r.beginScope()
-	r.scopes[len(r.scopes)-1]["this"] = true
+	defer r.endScope()
+	r.defineName("this")
 	for _, method := range stmt.Methods {
 		functionType := METHOD
 		if method.Name.Lexeme == "init" {
 			functionType = INITIALIZER
 		}
-		_, err := r.resolveFunction(method, functionType)
+		_, err := r.resolveFunction(method.Parameters, method.Body, functionType)
 		if err != nil {
 			return nil, err
 		}
 	}
-	r.endScope()
-
-	if stmt.Superclass != nil {
-		r.endScope()
-	}
 
 	return nil, nil
 }
@@ -181,6 +279,48 @@ func (r *Resolver) VisitBinaryExpr(expr *ast.BinaryExpr) (any, error) {
 	return r.resolveExpr(expr.Right)
 }
 
+func (r *Resolver) VisitFunctionExpr(expr *ast.FunctionExpr) (any, error) {
+	return r.resolveFunction(expr.Parameters, expr.Body, FUNCTION)
+}
+
+func (r *Resolver) VisitListExpr(expr *ast.ListExpr) (any, error) {
+	for _, element := range expr.Elements {
+		if _, err := r.resolveExpr(element); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitMapExpr(expr *ast.MapExpr) (any, error) {
+	for i, key := range expr.Keys {
+		if _, err := r.resolveExpr(key); err != nil {
+			return nil, err
+		}
+		if _, err := r.resolveExpr(expr.Values[i]); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitIndexExpr(expr *ast.IndexExpr) (any, error) {
+	if _, err := r.resolveExpr(expr.Object); err != nil {
+		return nil, err
+	}
+	return r.resolveExpr(expr.Index)
+}
+
+func (r *Resolver) VisitIndexSetExpr(expr *ast.IndexSetExpr) (any, error) {
+	if _, err := r.resolveExpr(expr.Object); err != nil {
+		return nil, err
+	}
+	if _, err := r.resolveExpr(expr.Index); err != nil {
+		return nil, err
+	}
+	return r.resolveExpr(expr.Value)
+}
+
 func (r *Resolver) VisitCallExpr(expr *ast.CallExpr) (any, error) {
 	if _, err := r.resolveExpr(expr.Callee); err != nil {
 		return nil, err
@@ -228,8 +368,8 @@ func (r *Resolver) VisitSetExpr(expr *ast.SetExpr) (any, error) {
 
 func (r *Resolver) VisitVariableExpr(expr *ast.VariableExpr) (any, error) {
 	if len(r.scopes) != 0 {
-		if val, exists := r.scopes[len(r.scopes)-1][expr.Name.Lexeme]; exists && !val {
-			return nil, fmt.Errorf("[Line %d] Error at '%v': Can't read local variable in its own initializer", expr.Name.Line, expr.Name.Lexeme)
+		if local, exists := r.scopes[len(r.scopes)-1][expr.Name.Lexeme]; exists && !local.defined {
+			return nil, newResolveError(expr.Name, "Can't read local variable in its own initializer")
 		}
 	}
 
@@ -238,49 +378,52 @@ func (r *Resolver) VisitVariableExpr(expr *ast.VariableExpr) (any, error) {
 
 func (r *Resolver) VisitThisExpr(expr *ast.ThisExpr) (any, error) {
 	if r.currentClass == NONECLASS {
-		return nil, fmt.Errorf("[Line %d] Can't use 'this' outside of a class", expr.Keyword.Line)
+		return nil, newResolveError(expr.Keyword, "Can't use 'this' outside of a class")
 	}
 	return r.resolveLocal(expr, expr.Keyword)
 }
 
 func (r *Resolver) VisitSuperExpr(expr *ast.SuperExpr) (any, error) {
 	if r.currentClass == NONECLASS {
-		return nil, fmt.Errorf("[Line %d] Can't use 'super' outside of a class", expr.Keyword.Line)
+		return nil, newResolveError(expr.Keyword, "Can't use 'super' outside of a class")
 	}
 	if r.currentClass == CLASS {
-		return nil, fmt.Errorf("[Line %d] Can't use 'super' in a class with no superclass", expr.Keyword.Line)
+		return nil, newResolveError(expr.Keyword, "Can't use 'super' in a class with no superclass")
 	}
 	return r.resolveLocal(expr, expr.Keyword)
 }
 
-func (r *Resolver) resolveFunction(stmt ast.FunctionStmt, decleration functionType) (any, error) {
+func (r *Resolver) resolveFunction(parameters []token.Token, body []ast.Stmt, decleration functionType) (any, error) {
 	previousFunctionType := r.currentFunction
+	previousLoopDepth := r.loopDepth
 	r.currentFunction = decleration
+	r.loopDepth = 0
 	defer func() {
 		r.currentFunction = previousFunctionType
+		r.loopDepth = previousLoopDepth
 	}()
 
 	r.beginScope()
 	defer r.endScope()
 
-	for _, token := range stmt.Parameters {
+	for _, token := range parameters {
 		if len(r.scopes) != 0 {
 			if _, exists := r.scopes[len(r.scopes)-1][token.Lexeme]; exists {
-				return nil, fmt.Errorf("[Line %d] Error at '%v': Already a parameter with this name in this scope", stmt.Name.Line, stmt.Name.Lexeme)
+				return nil, newResolveError(token, "Already a parameter with this name in this scope")
 			}
 		}
 		r.declare(token)
 		r.define(token)
 	}
 
-	return r.Resolve(stmt.Body)
+	return r.Resolve(body)
 }
 
 func (r *Resolver) resolveLocal(expr ast.Expr, name token.Token) (any, error) {
 	for i := len(r.scopes) - 1; i >= 0; i-- {
 		scope := r.scopes[i]
-		if _, exists := scope[name.Lexeme]; exists {
-			r.interpreter.resolve(expr, len(r.scopes)-1-i)
+		if local, exists := scope[name.Lexeme]; exists {
+			r.interpreter.resolve(expr, len(r.scopes)-1-i, local.slot)
 			break
 		}
 	}
@@ -308,7 +451,7 @@ func (r *Resolver) resolveExpr(expression ast.Expr) (any, error) {
 }
 
 func (r *Resolver) beginScope() {
-	r.scopes = append(r.scopes, make(map[string]bool, 0))
+	r.scopes = append(r.scopes, make(map[string]variable, 0))
 }
 
 func (r *Resolver) endScope() {
@@ -321,7 +464,7 @@ func (r *Resolver) declare(name token.Token) {
 	}
 
 	scope := r.scopes[len(r.scopes)-1]
-	scope[name.Lexeme] = false
+	scope[name.Lexeme] = variable{slot: len(scope)}
 }
 
 func (r *Resolver) define(name token.Token) {
@@ -330,5 +473,14 @@ func (r *Resolver) define(name token.Token) {
 	}
 
 	scope := r.scopes[len(r.scopes)-1]
-	scope[name.Lexeme] = true
+	local := scope[name.Lexeme]
+	local.defined = true
+	scope[name.Lexeme] = local
+}
+
+// defineName declares and defines a variable the interpreter binds
+// implicitly, such as this and super.
+func (r *Resolver) defineName(name string) {
+	r.declare(token.Token{Lexeme: name})
+	r.define(token.Token{Lexeme: name})
 }
@@ -0,0 +1,125 @@
+package interpreter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
+)
+
+// DEFAULT_MAX_DEPTH is how many Lox calls may be active at once before a
+// call fails with "Stack overflow.".
+const DEFAULT_MAX_DEPTH = 10000
+
+// MAX_DEPTH is the largest depth SetMaxDepth allows. Each Lox call takes
+// up to about 24KB of Go stack in the tree-walking interpreter, so deeper
+// recursion could crash the Go runtime before raising "Stack overflow.".
+const MAX_DEPTH = 25000
+
+// Frame is one active Lox function call. Line is the line of the call
+// expression that entered it.
+type Frame struct {
+	Function string
+	Class    string // set for methods
+	Line     int
+}
+
+func (f Frame) Name() string {
+	if f.Class != "" {
+		return f.Class + "." + f.Function
+	}
+	return f.Function
+}
+
+// callStack is shared by every copy of an Interpreter.
+type callStack struct {
+	frames   []Frame
+	maxDepth int
+	// call is the paren of the call expression about to call a function.
+	call token.Token
+}
+
+func (s *callStack) enter(call token.Token) {
+	if s != nil {
+		s.call = call
+	}
+}
+
+// site returns the paren of the call being made.
+func (s *callStack) site() token.Token {
+	if s == nil {
+		return token.Token{}
+	}
+	return s.call
+}
+
+func (s *callStack) push(function, class string) error {
+	if s == nil {
+		return nil
+	}
+	if len(s.frames) >= s.maxDepth {
+		return newRuntimeError(s.call, "Stack overflow.")
+	}
+	s.frames = append(s.frames, Frame{Function: function, Class: class, Line: s.call.Line})
+	return nil
+}
+
+func (s *callStack) pop() {
+	if s != nil {
+		s.frames = s.frames[:len(s.frames)-1]
+	}
+}
+
+// annotate attaches the current frames to a runtime error leaving the
+// innermost function it passes through, along with the file of the module
+// that function is in.
+func (s *callStack) annotate(err error, file string) error {
+	if runtimeErr, ok := err.(RuntimeError); ok && s != nil && runtimeErr.Trace == nil {
+		runtimeErr.Trace = slices.Clone(s.frames)
+		runtimeErr.File = file
+		return runtimeErr
+	}
+	return err
+}
+
+// Traceback formats the frames an error passed through, outermost first,
+// with the line each frame had reached. It is empty for errors raised
+// outside any function. Runs of more than three identical lines, as deep
+// recursion produces, are summarized.
+func (e RuntimeError) Traceback() string {
+	if len(e.Trace) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Traceback (most recent call last):\n")
+	last, repeated := fmt.Sprintf("  line %d, in <script>\n", e.Trace[0].Line), 0
+	b.WriteString(last)
+	for k, frame := range e.Trace {
+		line := e.Line
+		if k+1 < len(e.Trace) {
+			line = e.Trace[k+1].Line
+		}
+
+		entry := fmt.Sprintf("  line %d, in %s\n", line, frame.Name())
+		if entry == last {
+			repeated++
+			if repeated >= 3 {
+				continue
+			}
+		} else {
+			writeRepeats(&b, repeated)
+			last, repeated = entry, 0
+		}
+		b.WriteString(entry)
+	}
+	writeRepeats(&b, repeated)
+	return b.String()
+}
+
+func writeRepeats(b *strings.Builder, repeated int) {
+	if repeated > 2 {
+		fmt.Fprintf(b, "  [Previous line repeated %d more times]\n", repeated-2)
+	}
+}
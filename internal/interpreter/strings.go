@@ -0,0 +1,197 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Strings are indexed by rune, not byte: length, indexes and substr
+// positions all count Unicode code points.
+
+// StringProperty returns the property name of s: its length, or a native
+// implementing the string method name, bound to s.
+func StringProperty(s string, name string) (Value, bool) {
+	switch name {
+	case "length":
+		return float64(utf8.RuneCountInString(s)), true
+	case "upper":
+		return newAllocatingNative(name, 0, func(quota *Quota, args ...Value) (Value, error) {
+			return allocString(quota, strings.ToUpper(s))
+		}), true
+	case "lower":
+		return newAllocatingNative(name, 0, func(quota *Quota, args ...Value) (Value, error) {
+			return allocString(quota, strings.ToLower(s))
+		}), true
+	case "trim":
+		return newAllocatingNative(name, 0, func(quota *Quota, args ...Value) (Value, error) {
+			return allocString(quota, strings.TrimSpace(s))
+		}), true
+	case "split":
+		return newAllocatingNative(name, 1, func(quota *Quota, args ...Value) (Value, error) {
+			separator, err := stringArg(name, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			n := strings.Count(s, separator) + 1
+			if separator == "" {
+				n = utf8.RuneCountInString(s)
+			}
+			if err := quota.Charge(valueSize*n + len(s)); err != nil {
+				return nil, err
+			}
+			parts := strings.Split(s, separator)
+			elements := make([]Value, len(parts))
+			for i, part := range parts {
+				elements[i] = part
+			}
+			return NewLoxList(elements), nil
+		}), true
+	case "find":
+		return NewNativeFunction(name, 1, func(args ...Value) (Value, error) {
+			substr, err := stringArg(name, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			i := strings.Index(s, substr)
+			if i < 0 {
+				return float64(-1), nil
+			}
+			return float64(utf8.RuneCountInString(s[:i])), nil
+		}), true
+	case "replace":
+		return newAllocatingNative(name, 2, func(quota *Quota, args ...Value) (Value, error) {
+			old, err := stringArg(name, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			replacement, err := stringArg(name, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			size := len(s) + strings.Count(s, old)*(len(replacement)-len(old))
+			if err := quota.Charge(size); err != nil {
+				return nil, err
+			}
+			return strings.ReplaceAll(s, old, replacement), nil
+		}), true
+	case "substr":
+		return newAllocatingNative(name, VARIADIC, func(quota *Quota, args ...Value) (Value, error) {
+			if len(args) != 1 && len(args) != 2 {
+				return nil, fmt.Errorf("expected 1 or 2 arguments but got %d", len(args))
+			}
+			runes := []rune(s)
+			start, err := stringIndex(args[0], len(runes))
+			if err != nil {
+				return nil, err
+			}
+			end := len(runes)
+			if len(args) == 2 {
+				if end, err = stringIndex(args[1], len(runes)); err != nil {
+					return nil, err
+				}
+			}
+			if start > end {
+				return nil, errors.New("Substring start is after its end.")
+			}
+			return allocString(quota, string(runes[start:end]))
+		}), true
+	}
+	return nil, false
+}
+
+// allocString charges the bytes of a string a native built. It is for
+// strings no longer than those the native was given; longer ones are
+// charged before they are built.
+func allocString(quota *Quota, s string) (Value, error) {
+	if err := quota.Charge(len(s)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// allocStringify is Stringify for natives, charging the string's bytes as
+// they are written.
+func allocStringify(quota *Quota, value Value) (Value, error) {
+	switch value.(type) {
+	case *LoxList, *LoxMap:
+		b := quotaBuilder{quota: quota}
+		writeValue(&b, value, map[any]bool{})
+		if err := b.Err(); err != nil {
+			return nil, err
+		}
+		return b.String(), nil
+	}
+	return allocString(quota, Stringify(value))
+}
+
+// stringAt returns the character at index of s as a string.
+func stringAt(s string, index Value) (Value, error) {
+	runes := []rune(s)
+	i, err := stringIndex(index, len(runes)-1)
+	if err != nil {
+		return nil, err
+	}
+	return string(runes[i]), nil
+}
+
+// stringIndex checks that index is an integer in [0, max].
+func stringIndex(index Value, max int) (int, error) {
+	num, ok := index.(float64)
+	if !ok || num != math.Trunc(num) {
+		return 0, errors.New("String index must be an integer.")
+	}
+	if num < 0 || num > float64(max) {
+		return 0, errors.New("String index out of range.")
+	}
+	return int(num), nil
+}
+
+func stringArg(function string, args []Value, i int) (string, error) {
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("Argument %d to %s must be a string.", i+1, function)
+	}
+	return s, nil
+}
+
+// registerConversions adds the natives converting between strings, numbers
+// and characters.
+func registerConversions(registry *NativeRegistry) {
+	registry.registerAllocating("str", 1, func(quota *Quota, args ...Value) (Value, error) {
+		return allocStringify(quota, args[0])
+	})
+	// num returns nil for strings that aren't numbers, so scripts can check
+	// input without catching an error.
+	registry.Register("num", 1, func(args ...Value) (Value, error) {
+		switch arg := args[0].(type) {
+		case float64:
+			return arg, nil
+		case string:
+			num, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+			if err != nil {
+				return nil, nil
+			}
+			return num, nil
+		}
+		return nil, errors.New("Argument 1 to num must be a string or a number.")
+	})
+	registry.registerAllocating("chr", 1, func(quota *Quota, args ...Value) (Value, error) {
+		code, ok := args[0].(float64)
+		if !ok || code != math.Trunc(code) || code < 0 || code > utf8.MaxRune || !utf8.ValidRune(rune(code)) {
+			return nil, errors.New("Argument 1 to chr must be a Unicode code point.")
+		}
+		return allocString(quota, string(rune(code)))
+	})
+	registry.Register("ord", 1, func(args ...Value) (Value, error) {
+		s, ok := args[0].(string)
+		if !ok || utf8.RuneCountInString(s) != 1 {
+			return nil, errors.New("Argument 1 to ord must be a single character.")
+		}
+		r, _ := utf8.DecodeRuneInString(s)
+		return float64(r), nil
+	})
+}
@@ -0,0 +1,185 @@
+package interpreter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// ExitError stops a program that called exit. Like a BudgetError it can't
+// be caught and finally clauses don't run while it unwinds; the host decides
+// what exiting means.
+type ExitError struct {
+	Code int
+}
+
+func (e ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// SystemOptions configures the natives returned by System. Natives that
+// touch the file system or the environment are always defined, but fail
+// unless they are allowed.
+type SystemOptions struct {
+	Stdin io.Reader
+	// Stdout, if it buffers output, is flushed before readLine waits for
+	// input, so prompts are shown.
+	Stdout   io.Writer
+	Args     []string
+	AllowFS  bool
+	AllowEnv bool
+}
+
+var (
+	errFSNotAllowed  = errors.New("File system access is not allowed; run with --allow-fs.")
+	errEnvNotAllowed = errors.New("Environment access is not allowed; run with --allow-env.")
+)
+
+// System returns natives for scripts that automate things: reading and
+// writing files, reading standard input, script arguments, environment
+// variables and exit.
+func System(options SystemOptions) *NativeRegistry {
+	registry := NewNativeRegistry()
+	stdin := &lineReader{reader: bufio.NewReader(options.Stdin)}
+
+	registry.Register("readFile", 1, func(args ...Value) (Value, error) {
+		if !options.AllowFS {
+			return nil, errFSNotAllowed
+		}
+		path, err := stringArg("readFile", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fileError(err)
+		}
+		return string(contents), nil
+	})
+	registry.Register("writeFile", 2, func(args ...Value) (Value, error) {
+		return nil, writeFile("writeFile", options, args, os.O_TRUNC)
+	})
+	registry.Register("appendFile", 2, func(args ...Value) (Value, error) {
+		return nil, writeFile("appendFile", options, args, os.O_APPEND)
+	})
+	// readLine returns the next line of standard input without its line
+	// ending, or nil at the end of input.
+	registry.registerBlocking("readLine", 0, func(ctx context.Context, args ...Value) (Value, error) {
+		if flusher, ok := options.Stdout.(interface{ Flush() error }); ok {
+			if err := flusher.Flush(); err != nil {
+				return nil, err
+			}
+		}
+		line, err := stdin.readLine(ctx)
+		if err == io.EOF && line == "" {
+			return nil, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+	})
+	registry.Register("args", 0, func(args ...Value) (Value, error) {
+		elements := make([]Value, len(options.Args))
+		for i, arg := range options.Args {
+			elements[i] = arg
+		}
+		return NewLoxList(elements), nil
+	})
+	registry.Register("env", 1, func(args ...Value) (Value, error) {
+		if !options.AllowEnv {
+			return nil, errEnvNotAllowed
+		}
+		name, err := stringArg("env", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			return value, nil
+		}
+		return nil, nil
+	})
+	registry.Register("exit", 1, func(args ...Value) (Value, error) {
+		code, ok := args[0].(float64)
+		if !ok || code != math.Trunc(code) || code < 0 || code > 255 {
+			return nil, errors.New("Argument 1 to exit must be an integer from 0 to 255.")
+		}
+		return nil, ExitError{Code: int(code)}
+	})
+	return registry
+}
+
+// lineReader reads lines of input for readLine. While a context that can
+// be done is in force, it reads in the background, so the wait can be
+// abandoned when the program runs out of time; the line being read is then
+// kept for the next call.
+type lineReader struct {
+	reader  *bufio.Reader
+	pending chan lineResult
+}
+
+type lineResult struct {
+	line string
+	err  error
+}
+
+func (r *lineReader) readLine(ctx context.Context) (string, error) {
+	if r.pending == nil {
+		if ctx.Done() == nil {
+			return r.reader.ReadString('\n')
+		}
+		pending := make(chan lineResult, 1)
+		go func() {
+			line, err := r.reader.ReadString('\n')
+			pending <- lineResult{line: line, err: err}
+		}()
+		r.pending = pending
+	}
+
+	select {
+	case result := <-r.pending:
+		r.pending = nil
+		return result.line, result.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func writeFile(function string, options SystemOptions, args []Value, mode int) error {
+	if !options.AllowFS {
+		return errFSNotAllowed
+	}
+	path, err := stringArg(function, args, 0)
+	if err != nil {
+		return err
+	}
+	contents, err := stringArg(function, args, 1)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|mode, 0o644)
+	if err != nil {
+		return fileError(err)
+	}
+	if _, err := file.WriteString(contents); err != nil {
+		file.Close()
+		return fileError(err)
+	}
+	return fileError(file.Close())
+}
+
+// fileError turns an error from the os package into a message for Lox
+// code, such as "Can't open missing.txt: no such file or directory."
+func fileError(err error) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return fmt.Errorf("Can't %s %s: %v.", pathErr.Op, pathErr.Path, pathErr.Err)
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package interpreter
+
+import "errors"
+
+// BuiltinObject is implemented by runtime values, such as lists and maps,
+// whose methods are natives rather than Lox functions.
+type BuiltinObject interface {
+	Method(name string) (*NativeFunction, bool)
+}
+
+var errNotIndexable = errors.New("only lists, maps and strings can be indexed")
+
+// GetIndex evaluates object[index]. Errors carry only the message; callers
+// attach the source location.
+func GetIndex(object Value, index Value) (Value, error) {
+	switch o := object.(type) {
+	case *LoxList:
+		return o.Get(index)
+	case *LoxMap:
+		return o.Get(index)
+	case string:
+		return stringAt(o, index)
+	}
+	return nil, errNotIndexable
+}
+
+// SetIndex evaluates object[index] = value.
+func SetIndex(object Value, index Value, value Value) error {
+	switch o := object.(type) {
+	case *LoxList:
+		return o.Set(index, value)
+	case *LoxMap:
+		return o.Set(index, value)
+	case string:
+		return errors.New("Strings can't be modified.")
+	}
+	return errNotIndexable
+}
+
+// writeValue formats value as it appears inside a container, quoting
+// strings. Containers already being written print as "[...]" or "{...}",
+// so containers that hold themselves can still be printed. It stops once b
+// runs out of quota.
+func writeValue(b *quotaBuilder, value Value, seen map[any]bool) {
+	switch v := value.(type) {
+	case string:
+		b.WriteString(`"` + v + `"`)
+	case *LoxList:
+		if seen[v] {
+			b.WriteString("[...]")
+			return
+		}
+		seen[v] = true
+		defer delete(seen, v)
+
+		b.WriteString("[")
+		for i, element := range v.Elements {
+			if b.Err() != nil {
+				return
+			}
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeValue(b, element, seen)
+		}
+		b.WriteString("]")
+	case *LoxMap:
+		if seen[v] {
+			b.WriteString("{...}")
+			return
+		}
+		seen[v] = true
+		defer delete(seen, v)
+
+		b.WriteString("{")
+		for i, key := range v.keys {
+			if b.Err() != nil {
+				return
+			}
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeValue(b, key, seen)
+			b.WriteString(": ")
+			writeValue(b, v.values[key], seen)
+		}
+		b.WriteString("}")
+	default:
+		b.WriteString(Stringify(v))
+	}
+}
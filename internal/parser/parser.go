@@ -2,91 +2,155 @@ package parser
 
 import (
 	"fmt"
-	"os"
-
 	"slices"
+	"strings"
 
 	"github.com/codecrafters-io/interpreter-starter-go/internal/ast"
 	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
 )
 
+// ParseError describes a single syntax error. Expected lists the token kinds
+// that would have been accepted at Token, when the parser knows them, and Note
+// records where parsing picked up again after the error.
 type ParseError struct {
-	Token   token.Token
-	Message string
+	Token    token.Token
+	Line     int
+	Column   int
+	Expected []token.TokenType
+	Message  string
+	Note     string
 }
 
 func (e ParseError) Error() string {
-	return fmt.Sprintf("[line %d] Error at '%s': %s", e.Token.Line, e.Token.Lexeme, e.Message)
+	return fmt.Sprintf("[line %d] Error at '%s': %s", e.Line, e.Token.Lexeme, e.Message)
+}
+
+func (e ParseError) Span() token.Span {
+	return e.Token.Span()
+}
+
+// Hint lists the tokens the parser would have accepted, if it knows them.
+func (e ParseError) Hint() string {
+	if len(e.Expected) == 0 {
+		return ""
+	}
+
+	names := make([]string, len(e.Expected))
+	for i, t := range e.Expected {
+		names[i] = describe(t)
+	}
+	if len(names) == 1 {
+		return fmt.Sprintf("expected %s", names[0])
+	}
+	return fmt.Sprintf("expected one of %s", strings.Join(names, ", "))
+}
+
+// describe names a token type the way it is written: fixed tokens by their
+// lexeme, such as ')' or 'while', and the others by what they hold.
+func describe(t token.TokenType) string {
+	switch t {
+	case token.IDENTIFIER:
+		return "a name"
+	case token.NUMBER:
+		return "a number"
+	case token.STRING:
+		return "a string"
+	case token.EOF:
+		return "the end of the file"
+	}
+	// Punctuation types are their lexemes and keyword types are theirs in
+	// upper case.
+	return fmt.Sprintf("'%s'", strings.ToLower(string(t)))
+}
+
+var expressionStart = []token.TokenType{
+	token.NUMBER, token.STRING, token.IDENTIFIER, token.TRUE, token.FALSE,
+	token.NIL, token.THIS, token.SUPER, token.LEFT_PAREN, token.BANG, token.MINUS,
+	token.FUN, token.LEFT_BRACKET, token.LEFT_BRACE,
 }
 
 type Parser struct {
-	tokens   []token.Token
-	current  int
-	HadError bool
+	tokens  []token.Token
+	current int
+	errors  []ParseError
 }
 
 func NewParser(tokens []token.Token) *Parser {
 	return &Parser{
-		tokens:   tokens,
-		current:  0,
-		HadError: false,
+		tokens:  tokens,
+		current: 0,
 	}
 }
 
-func (p *Parser) Parse() []ast.Stmt {
+func (p *Parser) Parse() ([]ast.Stmt, []ParseError) {
 	var statements []ast.Stmt
 	for !p.isAtEnd() {
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					if _, ok := r.(ParseError); ok {
-						p.HadError = true
-						p.synchronize()
-					} else {
-						panic(r)
-					}
-				}
-			}()
-
+		p.recoverable(func() {
 			stmt := p.declaration()
 			if stmt != nil {
 				statements = append(statements, stmt)
 			}
-		}()
+		})
 	}
-	return statements
+	return statements, p.errors
 }
 
 // ParseExpressions for backward compatibility
-func (p *Parser) ParseExpressions() []ast.Expr {
+func (p *Parser) ParseExpressions() ([]ast.Expr, []ParseError) {
 	var expressions []ast.Expr
 	for !p.isAtEnd() {
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					if _, ok := r.(ParseError); ok {
-						p.HadError = true
-						p.synchronize()
-					} else {
-						panic(r)
-					}
-				}
-			}()
-
+		p.recoverable(func() {
 			expr := p.expression()
 			if expr != nil {
 				expressions = append(expressions, expr)
 			}
-		}()
+		})
 	}
-	return expressions
+	return expressions, p.errors
+}
+
+// recoverable runs parse, turning a ParseError panic into a recorded error
+// and skipping ahead to the next statement boundary.
+func (p *Parser) recoverable(parse func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			parseErr, ok := r.(ParseError)
+			if !ok {
+				panic(r)
+			}
+
+			p.synchronize()
+			if p.isAtEnd() {
+				parseErr.Note = "skipped to the end of input"
+			} else {
+				next := p.peek()
+				parseErr.Note = fmt.Sprintf("resumed parsing at '%s' on line %d", next.Lexeme, next.Line)
+			}
+			p.errors = append(p.errors, parseErr)
+		}
+	}()
+
+	parse()
 }
 
 func (p *Parser) declaration() ast.Stmt {
+	if p.match(token.EXPORT) {
+		return p.exportDeclaration()
+	}
+	if p.match(token.IMPORT) {
+		return p.importStatement()
+	}
+	// from is only a keyword at the start of a from import.
+	if p.check(token.IDENTIFIER) && p.peek().Lexeme == "from" && p.checkNext(token.STRING) {
+		p.advance()
+		return p.fromImportStatement()
+	}
 	if p.match(token.VAR) {
 		return p.varDeclaration()
 	}
-	if p.match(token.FUN) {
+	// Without a name, fun starts an anonymous function expression.
+	if p.check(token.FUN) && p.checkNext(token.IDENTIFIER) {
+		p.advance()
 		return p.function("function")
 	}
 	if p.match(token.CLASS) {
@@ -95,7 +159,44 @@ func (p *Parser) declaration() ast.Stmt {
 	return p.statement()
 }
 
+func (p *Parser) exportDeclaration() ast.Stmt {
+	keyword := p.previous()
+	if !p.check(token.VAR) && !p.check(token.CLASS) && !(p.check(token.FUN) && p.checkNext(token.IDENTIFIER)) {
+		p.error(p.peek(), "expect var, fun or class declaration after 'export'")
+	}
+	return &ast.ExportStmt{Keyword: keyword, Declaration: p.declaration()}
+}
+
+func (p *Parser) importStatement() ast.Stmt {
+	keyword := p.previous()
+	path := p.consume(token.STRING, "expect module path after 'import'")
+	if !p.check(token.IDENTIFIER) || p.peek().Lexeme != "as" {
+		p.error(p.peek(), "expect 'as' after module path")
+	}
+	p.advance()
+	alias := p.consume(token.IDENTIFIER, "expect module name after 'as'")
+	semicolon := p.consume(token.SEMICOLON, "expect ';' after import")
+	return &ast.ImportStmt{Keyword: keyword, Path: *path, Alias: *alias, Semicolon: *semicolon}
+}
+
+func (p *Parser) fromImportStatement() ast.Stmt {
+	keyword := p.previous()
+	path := p.consume(token.STRING, "expect module path after 'from'")
+	p.consume(token.IMPORT, "expect 'import' after module path")
+
+	var names []token.Token
+	for {
+		names = append(names, *p.consume(token.IDENTIFIER, "expect name to import"))
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+	semicolon := p.consume(token.SEMICOLON, "expect ';' after import")
+	return &ast.ImportStmt{Keyword: keyword, Path: *path, Names: names, Semicolon: *semicolon}
+}
+
 func (p *Parser) classDeclaration() ast.Stmt {
+	keyword := p.previous()
 	name := p.consume(token.IDENTIFIER, "expect class name")
 	var superclass *ast.VariableExpr = nil
 
@@ -110,14 +211,50 @@ func (p *Parser) classDeclaration() ast.Stmt {
 		methods = append(methods, *p.function("method"))
 	}
 
-	p.consume(token.RIGHT_BRACE, "expect '}' after class body")
-	return &ast.ClassStmt{Name: *name, Superclass: superclass, Methods: methods}
+	rightBrace := p.consume(token.RIGHT_BRACE, "expect '}' after class body")
+	return &ast.ClassStmt{
+		Keyword:    keyword,
+		Name:       *name,
+		Superclass: superclass,
+		Methods:    methods,
+		RightBrace: *rightBrace,
+	}
 }
 
 func (p *Parser) function(kind string) *ast.FunctionStmt {
+	var keyword token.Token
+	if p.previous().Type == token.FUN {
+		keyword = p.previous()
+	}
 	name := p.consume(token.IDENTIFIER, fmt.Sprintf("expect %s name", kind))
 	p.consume(token.LEFT_PAREN, fmt.Sprintf("expect '(' after %s name", kind))
+	parameters, body, rightBrace := p.functionBody(kind)
+
+	return &ast.FunctionStmt{
+		Keyword:    keyword,
+		Name:       *name,
+		Parameters: parameters,
+		Body:       body,
+		RightBrace: rightBrace,
+	}
+}
+
+func (p *Parser) functionExpression() ast.Expr {
+	keyword := p.previous()
+	p.consume(token.LEFT_PAREN, "expect '(' after 'fun'")
+	parameters, body, rightBrace := p.functionBody("function")
+
+	return &ast.FunctionExpr{
+		Keyword:    keyword,
+		Parameters: parameters,
+		Body:       body,
+		RightBrace: rightBrace,
+	}
+}
 
+// functionBody parses the parameter list and body following the opening
+// parenthesis of a function.
+func (p *Parser) functionBody(kind string) ([]token.Token, []ast.Stmt, token.Token) {
 	parameters := make([]token.Token, 0)
 	if !p.check(token.RIGHT_PAREN) {
 		for {
@@ -136,24 +273,20 @@ func (p *Parser) function(kind string) *ast.FunctionStmt {
 
 	p.consume(token.RIGHT_PAREN, "expect ')' after parameters")
 	p.consume(token.LEFT_BRACE, fmt.Sprintf("expect '{' before %s body", kind))
-	body := p.block()
-
-	return &ast.FunctionStmt{
-		Name:       *name,
-		Parameters: parameters,
-		Body:       body,
-	}
+	body, rightBrace := p.block()
+	return parameters, body, rightBrace
 }
 
 func (p *Parser) varDeclaration() ast.Stmt {
+	keyword := p.previous()
 	name := p.consume(token.IDENTIFIER, "expect variable name")
 	var initializer ast.Expr = nil
 	if p.match(token.EQUAL) {
 		initializer = p.expression()
 	}
 
-	p.consume(token.SEMICOLON, "expect ';' after variable declaration")
-	return &ast.VarStmt{Name: *name, Initializer: initializer}
+	semicolon := p.consume(token.SEMICOLON, "expect ';' after variable declaration")
+	return &ast.VarStmt{Keyword: keyword, Name: *name, Initializer: initializer, Semicolon: *semicolon}
 }
 
 func (p *Parser) statement() ast.Stmt {
@@ -172,8 +305,29 @@ func (p *Parser) statement() ast.Stmt {
 	if p.match(token.RETURN) {
 		return p.returnStatement()
 	}
-	if p.match(token.LEFT_BRACE) {
-		return &ast.BlockStmt{Statements: p.block()}
+	if p.match(token.THROW) {
+		return p.throwStatement()
+	}
+	if p.match(token.TRY) {
+		return p.tryStatement()
+	}
+	if p.match(token.BREAK) {
+		keyword := p.previous()
+		semicolon := p.consume(token.SEMICOLON, "expect ';' after 'break'")
+		return &ast.BreakStmt{Keyword: keyword, Semicolon: *semicolon}
+	}
+	if p.match(token.CONTINUE) {
+		keyword := p.previous()
+		semicolon := p.consume(token.SEMICOLON, "expect ';' after 'continue'")
+		return &ast.ContinueStmt{Keyword: keyword, Semicolon: *semicolon}
+	}
+	// A brace at the start of a statement opens a block, unless it is
+	// followed by a single token and a colon, which no block can start with.
+	if p.check(token.LEFT_BRACE) && !p.startsMapLiteral() {
+		p.advance()
+		leftBrace := p.previous()
+		statements, rightBrace := p.block()
+		return &ast.BlockStmt{LeftBrace: leftBrace, Statements: statements, RightBrace: rightBrace}
 	}
 
 	return p.expressionStatement()
@@ -186,14 +340,49 @@ func (p *Parser) returnStatement() ast.Stmt {
 		value = p.expression()
 	}
 
-	p.consume(token.SEMICOLON, "expect ';' after return value")
+	semicolon := p.consume(token.SEMICOLON, "expect ';' after return value")
 	return &ast.ReturnStmt{
-		Keyword: keyword,
-		Value:   value,
+		Keyword:   keyword,
+		Value:     value,
+		Semicolon: *semicolon,
 	}
 }
 
+func (p *Parser) throwStatement() ast.Stmt {
+	keyword := p.previous()
+	value := p.expression()
+	semicolon := p.consume(token.SEMICOLON, "expect ';' after thrown value")
+	return &ast.ThrowStmt{Keyword: keyword, Value: value, Semicolon: *semicolon}
+}
+
+func (p *Parser) tryStatement() ast.Stmt {
+	stmt := &ast.TryStmt{Keyword: p.previous()}
+	stmt.Body = p.blockStatement("expect '{' after 'try'")
+
+	if p.match(token.CATCH) {
+		p.consume(token.LEFT_PAREN, "expect '(' after 'catch'")
+		stmt.CatchName = *p.consume(token.IDENTIFIER, "expect catch variable name")
+		p.consume(token.RIGHT_PAREN, "expect ')' after catch variable")
+		stmt.Catch = p.blockStatement("expect '{' before catch body")
+	}
+	if p.match(token.FINALLY) {
+		stmt.Finally = p.blockStatement("expect '{' after 'finally'")
+	}
+
+	if stmt.Catch == nil && stmt.Finally == nil {
+		p.error(p.peek(), "expect 'catch' or 'finally' after try body", token.CATCH, token.FINALLY)
+	}
+	return stmt
+}
+
+func (p *Parser) blockStatement(message string) *ast.BlockStmt {
+	leftBrace := p.consume(token.LEFT_BRACE, message)
+	statements, rightBrace := p.block()
+	return &ast.BlockStmt{LeftBrace: *leftBrace, Statements: statements, RightBrace: rightBrace}
+}
+
 func (p *Parser) forStatement() ast.Stmt {
+	keyword := p.previous()
 	p.consume(token.LEFT_PAREN, "expect '(' after 'for'")
 
 	var initializer ast.Stmt = nil
@@ -218,16 +407,11 @@ func (p *Parser) forStatement() ast.Stmt {
 	p.consume(token.RIGHT_PAREN, "expect ')' after for clauses")
 
 	body := p.statement()
-	if increment != nil {
-		body = &ast.BlockStmt{
-			Statements: []ast.Stmt{body, &ast.ExpressionStmt{Expr: increment}},
-		}
-	}
 
 	if condition == nil {
 		condition = &ast.LiteralExpr{Value: true}
 	}
-	body = &ast.WhileStmt{Condition: condition, Body: body}
+	body = &ast.WhileStmt{Keyword: keyword, Condition: condition, Body: body, Increment: increment}
 
 	if initializer != nil {
 		body = &ast.BlockStmt{Statements: []ast.Stmt{initializer, body}}
@@ -237,14 +421,16 @@ func (p *Parser) forStatement() ast.Stmt {
 }
 
 func (p *Parser) whileStatement() ast.Stmt {
+	keyword := p.previous()
 	p.consume(token.LEFT_PAREN, "expect '(' after 'while'")
 	condition := p.expression()
 	p.consume(token.RIGHT_PAREN, "expect ')' after condition")
 	body := p.statement()
-	return &ast.WhileStmt{Body: body, Condition: condition}
+	return &ast.WhileStmt{Keyword: keyword, Body: body, Condition: condition}
 }
 
 func (p *Parser) ifStatement() ast.Stmt {
+	keyword := p.previous()
 	p.consume(token.LEFT_PAREN, "expect '(' after 'if'")
 	condition := p.expression()
 	p.consume(token.RIGHT_PAREN, "expect ')' after if condition")
@@ -256,13 +442,14 @@ func (p *Parser) ifStatement() ast.Stmt {
 	}
 
 	return &ast.IfStmt{
+		Keyword:    keyword,
 		Condition:  condition,
 		ThenBranch: thenBranchStmt,
 		ElseBranch: elseBranchStmt,
 	}
 }
 
-func (p *Parser) block() []ast.Stmt {
+func (p *Parser) block() ([]ast.Stmt, token.Token) {
 	stmts := make([]ast.Stmt, 0)
 	for !p.isAtEnd() && !p.check(token.RIGHT_BRACE) {
 		stmt := p.declaration()
@@ -271,20 +458,21 @@ func (p *Parser) block() []ast.Stmt {
 		}
 	}
 
-	p.consume(token.RIGHT_BRACE, "expect '}' after block")
-	return stmts
+	rightBrace := p.consume(token.RIGHT_BRACE, "expect '}' after block")
+	return stmts, *rightBrace
 }
 
 func (p *Parser) printStatement() ast.Stmt {
+	keyword := p.previous()
 	expr := p.expression()
-	p.consume(token.SEMICOLON, "expect ';' after value")
-	return &ast.PrintStmt{Expr: expr}
+	semicolon := p.consume(token.SEMICOLON, "expect ';' after value")
+	return &ast.PrintStmt{Keyword: keyword, Expr: expr, Semicolon: *semicolon}
 }
 
 func (p *Parser) expressionStatement() ast.Stmt {
 	expr := p.expression()
-	p.consume(token.SEMICOLON, "expect ';' after expression")
-	return &ast.ExpressionStmt{Expr: expr}
+	semicolon := p.consume(token.SEMICOLON, "expect ';' after expression")
+	return &ast.ExpressionStmt{Expr: expr, Semicolon: *semicolon}
 }
 
 func (p *Parser) expression() ast.Expr {
@@ -309,6 +497,13 @@ func (p *Parser) assignment() ast.Expr {
 				Name:   getExpr.Name,
 				Value:  value,
 			}
+		} else if indexExpr, ok := expr.(*ast.IndexExpr); ok {
+			return &ast.IndexSetExpr{
+				Object:  indexExpr.Object,
+				Bracket: indexExpr.Bracket,
+				Index:   indexExpr.Index,
+				Value:   value,
+			}
 		}
 
 		p.error(equals, "invalid assignment target")
@@ -407,6 +602,11 @@ func (p *Parser) call() ast.Expr {
 		} else if p.match(token.DOT) {
 			name := p.consume(token.IDENTIFIER, "expected identifier after '.'")
 			expr = &ast.GetExpr{Name: *name, Object: expr}
+		} else if p.match(token.LEFT_BRACKET) {
+			bracket := p.previous()
+			index := p.expression()
+			rightBracket := p.consume(token.RIGHT_BRACKET, "expect ']' after index")
+			expr = &ast.IndexExpr{Object: expr, Bracket: bracket, Index: index, RightBracket: *rightBracket}
 		} else {
 			break
 		}
@@ -434,23 +634,62 @@ func (p *Parser) finishCall(callee ast.Expr) ast.Expr {
 	return &ast.CallExpr{Callee: callee, Arguments: arguments, Paren: *parenToken}
 }
 
+// list parses the elements of a list literal. A trailing comma is allowed.
+func (p *Parser) list() ast.Expr {
+	leftBracket := p.previous()
+	elements := make([]ast.Expr, 0)
+	for !p.check(token.RIGHT_BRACKET) {
+		elements = append(elements, p.expression())
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+
+	rightBracket := p.consume(token.RIGHT_BRACKET, "expect ']' after list elements")
+	return &ast.ListExpr{LeftBracket: leftBracket, Elements: elements, RightBracket: *rightBracket}
+}
+
+// mapLiteral parses the entries of a map literal. A trailing comma is
+// allowed.
+func (p *Parser) mapLiteral() ast.Expr {
+	leftBrace := p.previous()
+	keys := make([]ast.Expr, 0)
+	values := make([]ast.Expr, 0)
+	for !p.check(token.RIGHT_BRACE) {
+		keys = append(keys, p.expression())
+		p.consume(token.COLON, "expect ':' after map key")
+		values = append(values, p.expression())
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+
+	rightBrace := p.consume(token.RIGHT_BRACE, "expect '}' after map entries")
+	return &ast.MapExpr{LeftBrace: leftBrace, Keys: keys, Values: values, RightBrace: *rightBrace}
+}
+
+func (p *Parser) startsMapLiteral() bool {
+	return p.current+2 < len(p.tokens) && p.tokens[p.current+2].Type == token.COLON
+}
+
 func (p *Parser) primary() ast.Expr {
 	if p.match(token.FALSE) {
-		return &ast.LiteralExpr{Value: false}
+		return &ast.LiteralExpr{Token: p.previous(), Value: false}
 	}
 	if p.match(token.TRUE) {
-		return &ast.LiteralExpr{Value: true}
+		return &ast.LiteralExpr{Token: p.previous(), Value: true}
 	}
 	if p.match(token.NIL) {
-		return &ast.LiteralExpr{Value: nil}
+		return &ast.LiteralExpr{Token: p.previous(), Value: nil}
 	}
 	if p.match(token.NUMBER, token.STRING) {
-		return &ast.LiteralExpr{Value: p.previous().Literal}
+		return &ast.LiteralExpr{Token: p.previous(), Value: p.previous().Literal}
 	}
 	if p.match(token.LEFT_PAREN) {
+		leftParen := p.previous()
 		expr := p.expression()
-		p.consume(token.RIGHT_PAREN, "expect ')' after expression")
-		return &ast.GroupingExpr{Expr: expr}
+		rightParen := p.consume(token.RIGHT_PAREN, "expect ')' after expression")
+		return &ast.GroupingExpr{LeftParen: leftParen, Expr: expr, RightParen: *rightParen}
 	}
 	if p.match(token.IDENTIFIER) {
 		return &ast.VariableExpr{Name: p.previous()}
@@ -458,6 +697,15 @@ func (p *Parser) primary() ast.Expr {
 	if p.match(token.THIS) {
 		return &ast.ThisExpr{Keyword: p.previous()}
 	}
+	if p.match(token.FUN) {
+		return p.functionExpression()
+	}
+	if p.match(token.LEFT_BRACKET) {
+		return p.list()
+	}
+	if p.match(token.LEFT_BRACE) {
+		return p.mapLiteral()
+	}
 	if p.match(token.SUPER) {
 		keyword := p.previous()
 		p.consume(token.DOT, "expect '.' after 'super'")
@@ -467,7 +715,7 @@ func (p *Parser) primary() ast.Expr {
 		}
 	}
 
-	p.error(p.peek(), "expect expression")
+	p.error(p.peek(), "expect expression", expressionStart...)
 	return nil
 }
 
@@ -484,14 +732,18 @@ func (p *Parser) consume(t token.TokenType, message string) *token.Token {
 		token := p.advance()
 		return &token
 	}
-	p.error(p.peek(), message)
+	p.error(p.peek(), message, t)
 	return nil
 }
 
-func (p *Parser) error(token token.Token, message string) {
-	p.HadError = true
-	fmt.Fprintf(os.Stderr, "[line %d] Error at '%s': %s\n", token.Line, token.Lexeme, message)
-	panic(ParseError{Token: token, Message: message})
+func (p *Parser) error(token token.Token, message string, expected ...token.TokenType) {
+	panic(ParseError{
+		Token:    token,
+		Line:     token.Line,
+		Column:   token.Column,
+		Expected: expected,
+		Message:  message,
+	})
 }
 
 func (p *Parser) check(t token.TokenType) bool {
@@ -501,6 +753,13 @@ func (p *Parser) check(t token.TokenType) bool {
 	return p.peek().Type == t
 }
 
+func (p *Parser) checkNext(t token.TokenType) bool {
+	if p.isAtEnd() {
+		return false
+	}
+	return p.tokens[p.current+1].Type == t
+}
+
 func (p *Parser) advance() token.Token {
 	if !p.isAtEnd() {
 		p.current++
@@ -529,7 +788,7 @@ func (p *Parser) synchronize() {
 		}
 
 		switch p.peek().Type {
-		case token.CLASS, token.FUN, token.VAR, token.FOR, token.IF, token.WHILE, token.PRINT, token.RETURN:
+		case token.CLASS, token.FUN, token.VAR, token.FOR, token.IF, token.WHILE, token.PRINT, token.RETURN, token.BREAK, token.CONTINUE, token.THROW, token.TRY, token.IMPORT, token.EXPORT:
 			return
 		}
 
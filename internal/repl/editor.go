@@ -0,0 +1,190 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+const (
+	keyCtrlA     = 0x01
+	keyCtrlB     = 0x02
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyCtrlF     = 0x06
+	keyCtrlK     = 0x0b
+	keyCtrlU     = 0x15
+	keyEnter     = '\r'
+	keyEscape    = 0x1b
+	keyBackspace = 0x7f
+	keyCtrlH     = 0x08
+)
+
+// terminalEditor is a small line editor supporting cursor movement, the
+// usual Emacs-style control keys and browsing history with the arrow keys.
+type terminalEditor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	fd      uintptr
+	history *history
+}
+
+func newTerminalEditor(in *os.File, out io.Writer, history *history) (*terminalEditor, bool) {
+	info, err := in.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil, false
+	}
+
+	// Check that raw mode is available before committing to the editor.
+	restore, err := makeRaw(in.Fd())
+	if err != nil {
+		return nil, false
+	}
+	restore()
+
+	return &terminalEditor{
+		in:      bufio.NewReader(in),
+		out:     out,
+		fd:      in.Fd(),
+		history: history,
+	}, true
+}
+
+func (e *terminalEditor) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	var line []rune
+	cursor := 0
+	historyIndex := len(e.history.entries)
+	draft := ""
+
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - cursor; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	setLine := func(s string) {
+		line = []rune(s)
+		cursor = len(line)
+		redraw()
+	}
+
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(line), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+			if cursor < len(line) {
+				line = append(line[:cursor], line[cursor+1:]...)
+			}
+		case keyBackspace, keyCtrlH:
+			if cursor > 0 {
+				line = append(line[:cursor-1], line[cursor:]...)
+				cursor--
+			}
+		case keyCtrlA:
+			cursor = 0
+		case keyCtrlE:
+			cursor = len(line)
+		case keyCtrlB:
+			cursor = max(cursor-1, 0)
+		case keyCtrlF:
+			cursor = min(cursor+1, len(line))
+		case keyCtrlK:
+			line = line[:cursor]
+		case keyCtrlU:
+			line = line[cursor:]
+			cursor = 0
+		case keyEscape:
+			switch e.readEscape() {
+			case 'A':
+				if historyIndex > 0 {
+					if historyIndex == len(e.history.entries) {
+						draft = string(line)
+					}
+					historyIndex--
+					setLine(e.history.entries[historyIndex])
+				}
+				continue
+			case 'B':
+				if historyIndex < len(e.history.entries) {
+					historyIndex++
+					if historyIndex == len(e.history.entries) {
+						setLine(draft)
+					} else {
+						setLine(e.history.entries[historyIndex])
+					}
+				}
+				continue
+			case 'C':
+				cursor = min(cursor+1, len(line))
+			case 'D':
+				cursor = max(cursor-1, 0)
+			case 'H':
+				cursor = 0
+			case 'F':
+				cursor = len(line)
+			case '3':
+				if cursor < len(line) {
+					line = append(line[:cursor], line[cursor+1:]...)
+				}
+			}
+		default:
+			if r == utf8.RuneError || r < ' ' {
+				continue
+			}
+			line = append(line[:cursor], append([]rune{r}, line[cursor:]...)...)
+			cursor++
+		}
+		redraw()
+	}
+}
+
+// readEscape consumes a CSI sequence and returns its final byte, or '3' for
+// the delete key.
+func (e *terminalEditor) readEscape() byte {
+	b, err := e.in.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return 0
+	}
+
+	b, err = e.in.ReadByte()
+	if err != nil {
+		return 0
+	}
+	if b >= '0' && b <= '9' {
+		// Sequences such as ESC [ 3 ~ carry a numeric parameter.
+		for {
+			next, err := e.in.ReadByte()
+			if err != nil || next == '~' {
+				break
+			}
+		}
+	}
+	return b
+}
+
+func (e *terminalEditor) Close() error {
+	return nil
+}
@@ -0,0 +1,47 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+	Close() error
+}
+
+// newLineReader returns an editing reader when in is a terminal that can be
+// put into raw mode, and a plain buffered reader otherwise.
+func newLineReader(in *os.File, out io.Writer, history *history) lineReader {
+	if editor, ok := newTerminalEditor(in, out, history); ok {
+		return editor
+	}
+	return &plainReader{in: bufio.NewReader(in), out: out}
+}
+
+type plainReader struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	line, err := r.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (r *plainReader) Close() error {
+	return nil
+}
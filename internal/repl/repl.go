@@ -0,0 +1,229 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/diagnostics"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/interpreter"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
+)
+
+const (
+	prompt             = "> "
+	continuationPrompt = ". "
+)
+
+const help = `Enter Lox statements, or a bare expression to print its value.
+Input continues on the next line until braces are balanced and the
+statement is terminated. An empty line submits incomplete input as is.
+
+  :load <file>  run a file in the current session
+  :history      show previous inputs
+  :help         show this message
+  :quit         leave the REPL (Ctrl-D works too)`
+
+// Session keeps one interpreter and resolver alive across inputs, so
+// globals, functions and classes defined earlier stay visible.
+type Session struct {
+	interpreter interpreter.Interpreter
+	resolver    interpreter.Resolver
+	out         io.Writer
+	errOut      io.Writer
+	colorMode   diagnostics.ColorMode
+}
+
+func NewSession(out, errOut io.Writer, colorMode diagnostics.ColorMode) *Session {
+	interpreterInstance := interpreter.NewInterpreter()
+	interpreterInstance.SetStdout(out)
+	return &Session{
+		interpreter: interpreterInstance,
+		resolver:    interpreter.NewResolver(interpreterInstance),
+		out:         out,
+		errOut:      errOut,
+		colorMode:   colorMode,
+	}
+}
+
+// Eval runs one chunk of input. It reports incomplete without running
+// anything when the input stops in the middle of a string, block or
+// statement, unless force is set.
+func (s *Session) Eval(source string, force bool) (incomplete bool) {
+	reporter := diagnostics.NewRenderer(s.errOut, source, s.colorMode)
+
+	sc := scanner.NewScanner(source)
+	tokens, err := sc.ScanTokens()
+	if err != nil {
+		var scanErr scanner.ScanError
+		if !force && errors.As(err, &scanErr) && scanErr.Message == "Unterminated string." {
+			return true
+		}
+		reporter.Report(err)
+		return false
+	}
+
+	statements, parseErrors := parser.NewParser(tokens).Parse()
+	if len(parseErrors) > 0 {
+		if expr, ok := parseBareExpression(tokens); ok {
+			s.evalExpression(reporter, expr)
+			return false
+		}
+		if !force && endsEarly(parseErrors) {
+			return true
+		}
+		for _, err := range parseErrors {
+			reporter.Report(err)
+		}
+		return false
+	}
+
+	s.run(reporter, statements)
+	return false
+}
+
+// LoadFile runs the Lox program at path in the current session.
+func (s *Session) LoadFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	s.Eval(string(contents), true)
+	return nil
+}
+
+func (s *Session) run(reporter *diagnostics.Renderer, statements []ast.Stmt) {
+	if _, err := s.resolver.Resolve(statements); err != nil {
+		reporter.Report(err)
+		return
+	}
+
+	for _, stmt := range statements {
+		if _, err := stmt.Accept(&s.interpreter); err != nil {
+			reporter.Report(err)
+			return
+		}
+	}
+}
+
+func (s *Session) evalExpression(reporter *diagnostics.Renderer, expr ast.Expr) {
+	if _, err := s.resolver.Resolve([]ast.Stmt{&ast.ExpressionStmt{Expr: expr}}); err != nil {
+		reporter.Report(err)
+		return
+	}
+
+	value, err := s.interpreter.Interpret(expr)
+	if err != nil {
+		reporter.Report(err)
+		return
+	}
+	fmt.Fprintln(s.out, interpreter.Stringify(value))
+}
+
+// parseBareExpression accepts input that is exactly one expression with no
+// trailing semicolon.
+func parseBareExpression(tokens []token.Token) (ast.Expr, bool) {
+	expressions, parseErrors := parser.NewParser(tokens).ParseExpressions()
+	if len(parseErrors) > 0 || len(expressions) != 1 {
+		return nil, false
+	}
+	return expressions[0], true
+}
+
+func endsEarly(parseErrors []parser.ParseError) bool {
+	for _, err := range parseErrors {
+		if err.Token.Type == token.EOF {
+			return true
+		}
+	}
+	return false
+}
+
+// Run reads inputs until end of input or :quit. History is kept in the file
+// at historyPath when it is not empty.
+func Run(in *os.File, out, errOut io.Writer, colorMode diagnostics.ColorMode, historyPath string) error {
+	history := newHistory(historyPath)
+	reader := newLineReader(in, out, history)
+	defer reader.Close()
+
+	session := NewSession(out, errOut, colorMode)
+	var pending strings.Builder
+	for {
+		currentPrompt := prompt
+		if pending.Len() > 0 {
+			currentPrompt = continuationPrompt
+		}
+
+		line, err := reader.ReadLine(currentPrompt)
+		if err == io.EOF {
+			fmt.Fprintln(out)
+			return nil
+		}
+		if err == errInterrupted {
+			pending.Reset()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if pending.Len() == 0 {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, ":") {
+				if quit := runCommand(session, trimmed, out, errOut, history); quit {
+					return nil
+				}
+				continue
+			}
+		}
+
+		force := pending.Len() > 0 && strings.TrimSpace(line) == ""
+		pending.WriteString(line)
+		pending.WriteString("\n")
+
+		source := pending.String()
+		if session.Eval(source, force) {
+			continue
+		}
+
+		history.add(strings.TrimRight(source, "\n"))
+		pending.Reset()
+	}
+}
+
+func runCommand(session *Session, command string, out, errOut io.Writer, history *history) (quit bool) {
+	name, arg, _ := strings.Cut(command, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":quit", ":exit", ":q":
+		return true
+	case ":help":
+		fmt.Fprintln(out, help)
+	case ":history":
+		for i, entry := range history.entries {
+			fmt.Fprintf(out, "%4d  %s\n", i+1, strings.ReplaceAll(entry, "\n", "\n      "))
+		}
+	case ":load":
+		if arg == "" {
+			fmt.Fprintln(errOut, "usage: :load <file>")
+			break
+		}
+		if err := session.LoadFile(arg); err != nil {
+			fmt.Fprintf(errOut, "Error reading file: %v\n", err)
+		}
+		history.add(command)
+	default:
+		fmt.Fprintf(errOut, "unknown command %s, try :help\n", name)
+	}
+	return false
+}
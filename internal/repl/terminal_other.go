@@ -0,0 +1,11 @@
+//go:build !linux
+
+package repl
+
+import (
+	"errors"
+)
+
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("line editing is not supported on this platform")
+}
@@ -7,21 +7,42 @@ import (
 	"github.com/codecrafters-io/interpreter-starter-go/internal/token"
 )
 
+// ScanError reports a character sequence the scanner could not turn into a
+// token.
+type ScanError struct {
+	Message string
+	Line    int
+	Source  token.Span
+}
+
+func (e ScanError) Error() string {
+	return fmt.Sprintf("[line %d] Error: %s", e.Line, e.Message)
+}
+
+func (e ScanError) Span() token.Span {
+	return e.Source
+}
+
 type Scanner struct {
-	input   string
-	tokens  []token.Token
-	start   int
-	current int
-	line    int
+	input     string
+	tokens    []token.Token
+	start     int
+	current   int
+	line      int
+	lineStart int
+
+	startLine   int
+	startColumn int
 }
 
 func NewScanner(input string) Scanner {
 	return Scanner{
-		input:   input,
-		tokens:  make([]token.Token, 0),
-		start:   0,
-		current: 0,
-		line:    1,
+		input:     input,
+		tokens:    make([]token.Token, 0),
+		start:     0,
+		current:   0,
+		line:      1,
+		lineStart: 0,
 	}
 }
 
@@ -47,8 +68,11 @@ func (s *Scanner) ScanTokens() ([]token.Token, error) {
 }
 
 func (s *Scanner) Scan() (*token.Token, error) {
+	s.startLine = s.line
+	s.startColumn = s.start - s.lineStart + 1
+
 	if s.isAtEnd() {
-		return &token.Token{Type: token.EOF, Lexeme: "EOF", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.EOF, "EOF", nil), nil
 	}
 
 	defer func() {
@@ -58,88 +82,101 @@ func (s *Scanner) Scan() (*token.Token, error) {
 	switch s.peak() {
 	case '(':
 		s.advance()
-		return &token.Token{Type: token.LEFT_PAREN, Lexeme: "(", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.LEFT_PAREN, "(", nil), nil
 	case ')':
 		s.advance()
-		return &token.Token{Type: token.RIGHT_PAREN, Lexeme: ")", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.RIGHT_PAREN, ")", nil), nil
 	case '{':
 		s.advance()
-		return &token.Token{Type: token.LEFT_BRACE, Lexeme: "{", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.LEFT_BRACE, "{", nil), nil
 	case '}':
 		s.advance()
-		return &token.Token{Type: token.RIGHT_BRACE, Lexeme: "}", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.RIGHT_BRACE, "}", nil), nil
+	case '[':
+		s.advance()
+		return s.makeToken(token.LEFT_BRACKET, "[", nil), nil
+	case ']':
+		s.advance()
+		return s.makeToken(token.RIGHT_BRACKET, "]", nil), nil
 	case ',':
 		s.advance()
-		return &token.Token{Type: token.COMMA, Lexeme: ",", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.COMMA, ",", nil), nil
 	case '.':
 		s.advance()
-		return &token.Token{Type: token.DOT, Lexeme: ".", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.DOT, ".", nil), nil
 	case '*':
 		s.advance()
-		return &token.Token{Type: token.STAR, Lexeme: "*", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.STAR, "*", nil), nil
 	case '+':
 		s.advance()
-		return &token.Token{Type: token.PLUS, Lexeme: "+", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.PLUS, "+", nil), nil
 	case '-':
 		s.advance()
-		return &token.Token{Type: token.MINUS, Lexeme: "-", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.MINUS, "-", nil), nil
 	case ';':
 		s.advance()
-		return &token.Token{Type: token.SEMICOLON, Lexeme: ";", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.SEMICOLON, ";", nil), nil
+	case ':':
+		s.advance()
+		return s.makeToken(token.COLON, ":", nil), nil
 	case '=':
 		s.advance()
 		if s.peak() == '=' {
 			s.advance()
-			return &token.Token{Type: token.EQUAL_EQUAL, Lexeme: "==", Literal: nil, Line: s.line}, nil
+			return s.makeToken(token.EQUAL_EQUAL, "==", nil), nil
 		}
-		return &token.Token{Type: token.EQUAL, Lexeme: "=", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.EQUAL, "=", nil), nil
 	case '!':
 		s.advance()
 		if s.peak() == '=' {
 			s.advance()
-			return &token.Token{Type: token.BANG_EQUAL, Lexeme: "!=", Literal: nil, Line: s.line}, nil
+			return s.makeToken(token.BANG_EQUAL, "!=", nil), nil
 		}
-		return &token.Token{Type: token.BANG, Lexeme: "!", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.BANG, "!", nil), nil
 	case '<':
 		s.advance()
 		if s.peak() == '=' {
 			s.advance()
-			return &token.Token{Type: token.LESS_EQUAL, Lexeme: "<=", Literal: nil, Line: s.line}, nil
+			return s.makeToken(token.LESS_EQUAL, "<=", nil), nil
 		}
-		return &token.Token{Type: token.LESS, Lexeme: "<", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.LESS, "<", nil), nil
 	case '>':
 		s.advance()
 		if s.peak() == '=' {
 			s.advance()
-			return &token.Token{Type: token.GREATER_EQUAL, Lexeme: ">=", Literal: nil, Line: s.line}, nil
+			return s.makeToken(token.GREATER_EQUAL, ">=", nil), nil
 		}
-		return &token.Token{Type: token.GREATER, Lexeme: ">", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.GREATER, ">", nil), nil
 	case '/':
 		s.advance()
 		if s.peak() == '/' {
 			for ; !s.isAtEnd(); s.advance() {
 				if s.peak() == '\n' {
 					s.advance()
-					s.line++
+					s.newline()
 					break
 				}
 			}
 			return nil, nil
 		}
-		return &token.Token{Type: token.SLASH, Lexeme: "/", Literal: nil, Line: s.line}, nil
+		return s.makeToken(token.SLASH, "/", nil), nil
 	case ' ', '\r', '\t':
 		s.advance()
 		return nil, nil
 	case '\n':
 		s.advance()
-		s.line++
+		s.newline()
 		return nil, nil
 	case '"':
 		s.advance()
 		for s.peak() != '"' {
 			if s.isAtEnd() {
-				var err = fmt.Errorf("[line %d] Error: Unterminated string.", s.line)
-				return nil, err
+				return nil, s.error("Unterminated string.")
+			}
+			if s.peak() == '\n' {
+				s.advance()
+				s.newline()
+				continue
 			}
 			s.advance()
 		}
@@ -147,7 +184,7 @@ func (s *Scanner) Scan() (*token.Token, error) {
 		literal := s.input[s.start+1 : s.current]
 		s.advance()
 
-		return &token.Token{Type: token.STRING, Lexeme: fmt.Sprintf("\"%s\"", literal), Literal: literal, Line: s.line}, nil
+		return s.makeToken(token.STRING, fmt.Sprintf("\"%s\"", literal), literal), nil
 	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
 		for s.isDigit(s.peak()) {
 			s.advance()
@@ -163,7 +200,7 @@ func (s *Scanner) Scan() (*token.Token, error) {
 		literal := s.input[s.start:s.current]
 		num, _ := strconv.ParseFloat(literal, 64)
 
-		return &token.Token{Type: token.NUMBER, Lexeme: literal, Literal: num, Line: s.line}, nil
+		return s.makeToken(token.NUMBER, literal, num), nil
 	default:
 		if s.isAlpha(s.peak()) {
 			for s.isAlphaNumeric(s.peak()) {
@@ -172,18 +209,42 @@ func (s *Scanner) Scan() (*token.Token, error) {
 
 			literal := s.input[s.start:s.current]
 			if keyword, ok := token.Keywords[literal]; ok {
-				return &token.Token{Type: keyword, Lexeme: literal, Literal: nil, Line: s.line}, nil
+				return s.makeToken(keyword, literal, nil), nil
 			}
 
-			return &token.Token{Type: token.IDENTIFIER, Lexeme: literal, Literal: nil, Line: s.line}, nil
+			return s.makeToken(token.IDENTIFIER, literal, nil), nil
 		} else {
-			var err = fmt.Errorf("[line %d] Error: Unexpected character: %c", s.line, s.peak())
 			s.advance()
-			return nil, err
+			return nil, s.error(fmt.Sprintf("Unexpected character: %c", s.input[s.start]))
 		}
 	}
 }
 
+func (s *Scanner) makeToken(t token.TokenType, lexeme string, literal any) *token.Token {
+	return &token.Token{
+		Type:    t,
+		Lexeme:  lexeme,
+		Literal: literal,
+		Line:    s.startLine,
+		Column:  s.startColumn,
+		Start:   s.start,
+		End:     s.current,
+	}
+}
+
+func (s *Scanner) error(message string) ScanError {
+	return ScanError{
+		Message: message,
+		Line:    s.startLine,
+		Source:  token.Span{Start: s.start, End: s.current, Line: s.startLine, Column: s.startColumn},
+	}
+}
+
+func (s *Scanner) newline() {
+	s.line++
+	s.lineStart = s.current
+}
+
 func (s *Scanner) advance() {
 	s.current++
 }
@@ -12,6 +12,48 @@ type Token struct {
 	Lexeme  string
 	Literal any
 	Line    int
+	Column  int
+	Start   int
+	End     int
+}
+
+func (t Token) Span() Span {
+	if t.Line == 0 {
+		return Span{}
+	}
+	return Span{Start: t.Start, End: t.End, Line: t.Line, Column: t.Column}
+}
+
+// Span is the half-open byte range [Start, End) of a piece of source text,
+// along with the line and column it begins at. The zero Span marks nodes the
+// parser synthesized without any source of their own.
+type Span struct {
+	Start  int
+	End    int
+	Line   int
+	Column int
+}
+
+func (s Span) IsZero() bool {
+	return s.Line == 0
+}
+
+// Join returns the smallest span covering both s and other.
+func (s Span) Join(other Span) Span {
+	if s.IsZero() {
+		return other
+	}
+	if other.IsZero() {
+		return s
+	}
+
+	if other.Start < s.Start {
+		s.Start, s.Line, s.Column = other.Start, other.Line, other.Column
+	}
+	if other.End > s.End {
+		s.End = other.End
+	}
+	return s
 }
 
 func (t Token) String() string {
@@ -26,6 +68,10 @@ func (t Token) String() string {
 		return fmt.Sprintf("LEFT_BRACE %s null", t.Type)
 	case RIGHT_BRACE:
 		return fmt.Sprintf("RIGHT_BRACE %s null", t.Type)
+	case LEFT_BRACKET:
+		return fmt.Sprintf("LEFT_BRACKET %s null", t.Type)
+	case RIGHT_BRACKET:
+		return fmt.Sprintf("RIGHT_BRACKET %s null", t.Type)
 	case COMMA:
 		return fmt.Sprintf("COMMA %s null", t.Type)
 	case DOT:
@@ -40,6 +86,8 @@ func (t Token) String() string {
 		return fmt.Sprintf("SLASH %s null", t.Type)
 	case SEMICOLON:
 		return fmt.Sprintf("SEMICOLON %s null", t.Type)
+	case COLON:
+		return fmt.Sprintf("COLON %s null", t.Type)
 	case EQUAL:
 		return fmt.Sprintf("EQUAL %s null", t.Type)
 	case EQUAL_EQUAL:
@@ -78,6 +126,9 @@ const (
 	LEFT_BRACE  TokenType = "{"
 	RIGHT_BRACE TokenType = "}"
 
+	LEFT_BRACKET  TokenType = "["
+	RIGHT_BRACKET TokenType = "]"
+
 	COMMA     TokenType = ","
 	DOT       TokenType = "."
 	STAR      TokenType = "*"
@@ -85,6 +136,7 @@ const (
 	MINUS     TokenType = "-"
 	SLASH     TokenType = "/"
 	SEMICOLON TokenType = ";"
+	COLON     TokenType = ":"
 
 	EQUAL       TokenType = "="
 	EQUAL_EQUAL TokenType = "=="
@@ -104,39 +156,55 @@ const (
 
 	IDENTIFIER TokenType = "IDENTIFIER"
 
-	AND    TokenType = "AND"
-	CLASS  TokenType = "CLASS"
-	ELSE   TokenType = "ELSE"
-	FALSE  TokenType = "FALSE"
-	FUN    TokenType = "FUN"
-	FOR    TokenType = "FOR"
-	IF     TokenType = "IF"
-	NIL    TokenType = "NIL"
-	OR     TokenType = "OR"
-	PRINT  TokenType = "PRINT"
-	RETURN TokenType = "RETURN"
-	SUPER  TokenType = "SUPER"
-	THIS   TokenType = "THIS"
-	TRUE   TokenType = "TRUE"
-	VAR    TokenType = "VAR"
-	WHILE  TokenType = "WHILE"
+	AND      TokenType = "AND"
+	BREAK    TokenType = "BREAK"
+	CATCH    TokenType = "CATCH"
+	CLASS    TokenType = "CLASS"
+	CONTINUE TokenType = "CONTINUE"
+	ELSE     TokenType = "ELSE"
+	EXPORT   TokenType = "EXPORT"
+	FALSE    TokenType = "FALSE"
+	FINALLY  TokenType = "FINALLY"
+	FUN      TokenType = "FUN"
+	FOR      TokenType = "FOR"
+	IF       TokenType = "IF"
+	IMPORT   TokenType = "IMPORT"
+	NIL      TokenType = "NIL"
+	OR       TokenType = "OR"
+	PRINT    TokenType = "PRINT"
+	RETURN   TokenType = "RETURN"
+	SUPER    TokenType = "SUPER"
+	THIS     TokenType = "THIS"
+	THROW    TokenType = "THROW"
+	TRUE     TokenType = "TRUE"
+	TRY      TokenType = "TRY"
+	VAR      TokenType = "VAR"
+	WHILE    TokenType = "WHILE"
 )
 
 var Keywords = map[string]TokenType{
-	"and":    AND,
-	"class":  CLASS,
-	"else":   ELSE,
-	"false":  FALSE,
-	"for":    FOR,
-	"fun":    FUN,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
-	"print":  PRINT,
-	"return": RETURN,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"var":    VAR,
-	"while":  WHILE,
+	"and":      AND,
+	"break":    BREAK,
+	"catch":    CATCH,
+	"class":    CLASS,
+	"continue": CONTINUE,
+	"else":     ELSE,
+	"export":   EXPORT,
+	"false":    FALSE,
+	"finally":  FINALLY,
+	"for":      FOR,
+	"fun":      FUN,
+	"if":       IF,
+	"import":   IMPORT,
+	"nil":      NIL,
+	"or":       OR,
+	"print":    PRINT,
+	"return":   RETURN,
+	"super":    SUPER,
+	"this":     THIS,
+	"throw":    THROW,
+	"true":     TRUE,
+	"try":      TRY,
+	"var":      VAR,
+	"while":    WHILE,
 }
@@ -0,0 +1,75 @@
+package vm
+
+import (
+	"github.com/codecrafters-io/interpreter-starter-go/internal/compiler"
+)
+
+type closure struct {
+	function *compiler.Function
+	upvalues []*upvalue
+}
+
+func newClosure(function *compiler.Function) *closure {
+	return &closure{
+		function: function,
+		upvalues: make([]*upvalue, function.UpvalueCount),
+	}
+}
+
+func (c *closure) String() string {
+	return c.function.String()
+}
+
+// upvalue points at a stack slot while the captured variable is still live
+// and holds the value itself once the slot has been popped.
+type upvalue struct {
+	location int
+	closed   any
+	isClosed bool
+	next     *upvalue
+}
+
+type class struct {
+	name    string
+	methods map[string]*closure
+}
+
+func newClass(name string) *class {
+	return &class{
+		name:    name,
+		methods: make(map[string]*closure),
+	}
+}
+
+func (c *class) String() string {
+	return c.name
+}
+
+type instance struct {
+	class  *class
+	fields map[string]any
+}
+
+func newInstance(class *class) *instance {
+	return &instance{
+		class:  class,
+		fields: make(map[string]any),
+	}
+}
+
+func (i *instance) Fields() map[string]any {
+	return i.fields
+}
+
+func (i *instance) String() string {
+	return i.class.name + " instance"
+}
+
+type boundMethod struct {
+	receiver any
+	method   *closure
+}
+
+func (b *boundMethod) String() string {
+	return b.method.String()
+}
@@ -0,0 +1,654 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/compiler"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/interpreter"
+)
+
+type callFrame struct {
+	closure *closure
+	ip      int
+	slots   int
+}
+
+// handler is an exception handler installed by a try statement. Unwinding
+// to it restores the frame and stack depth the statement started at.
+// Handlers for finally clauses receive the error itself, to rethrow it
+// unchanged.
+type handler struct {
+	frameCount  int
+	stackHeight int
+	ip          int
+	finally     bool
+}
+
+// pendingError is the error a finally clause rethrows once it has run.
+type pendingError struct {
+	err error
+}
+
+type VM struct {
+	frames       []callFrame
+	stack        []any
+	globals      map[string]any
+	openUpvalues *upvalue
+	handlers     []handler
+	errorClass   *class
+	stdout       io.Writer
+	maxDepth     int
+	budget       *interpreter.Budget
+}
+
+func NewVM() *VM {
+	vm := &VM{
+		frames:   make([]callFrame, 0, 64),
+		stack:    make([]any, 0, 256),
+		globals:  make(map[string]any),
+		stdout:   os.Stdout,
+		maxDepth: interpreter.DEFAULT_MAX_DEPTH,
+		budget:   interpreter.NewBudget(),
+	}
+	vm.Install(interpreter.Builtins())
+
+	prelude, err := compiler.Compile(interpreter.ParsePrelude())
+	if err != nil {
+		panic(err)
+	}
+	if err := vm.Interpret(prelude); err != nil {
+		panic(err)
+	}
+	vm.errorClass = vm.globals["Error"].(*class)
+	return vm
+}
+
+// Install defines every native and namespace in registry as a global.
+func (vm *VM) Install(registry *interpreter.NativeRegistry) {
+	for _, native := range registry.Natives() {
+		vm.globals[native.Name()] = native
+	}
+	for _, ns := range registry.Namespaces() {
+		vm.globals[ns.Name()] = ns
+	}
+}
+
+// SetStdout redirects the output of print statements.
+func (vm *VM) SetStdout(w io.Writer) {
+	vm.stdout = w
+}
+
+// SetMaxDepth sets how many Lox calls may be active at once, not counting
+// the script itself. Like the tree-walking interpreter, it lowers depths
+// above interpreter.MAX_DEPTH to it.
+func (vm *VM) SetMaxDepth(depth int) {
+	vm.maxDepth = min(depth, interpreter.MAX_DEPTH)
+}
+
+// SetContext makes the program stop with an interpreter.BudgetError once
+// ctx is done.
+func (vm *VM) SetContext(ctx context.Context) {
+	vm.budget.SetContext(ctx)
+}
+
+// SetMaxSteps limits how many loop iterations and calls to Lox functions
+// and classes the program may take from now on; calls to natives are free.
+// Zero means no limit.
+func (vm *VM) SetMaxSteps(steps int) {
+	vm.budget.SetMaxSteps(steps)
+}
+
+// Interpret runs a compiled script. Runtime errors are reported with the
+// same types and messages as the tree-walking interpreter.
+func (vm *VM) Interpret(script *compiler.Function) error {
+	cl := newClosure(script)
+	vm.push(cl)
+	if err := vm.call(cl, 0); err != nil {
+		return err
+	}
+
+	for {
+		err := vm.run()
+		if err == nil {
+			return nil
+		}
+		if !vm.catch(err) {
+			vm.resetStack()
+			return err
+		}
+	}
+}
+
+// catch unwinds to the innermost exception handler and pushes the value
+// the catch clause binds. It reports false when no handler can take err.
+func (vm *VM) catch(err error) bool {
+	var runtimeErr interpreter.RuntimeError
+	if len(vm.handlers) == 0 || !errors.As(err, &runtimeErr) {
+		return false
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.closeUpvalues(h.stackHeight)
+	vm.frames = vm.frames[:h.frameCount]
+	vm.stack = vm.stack[:h.stackHeight]
+	vm.frames[len(vm.frames)-1].ip = h.ip
+
+	if h.finally {
+		vm.push(&pendingError{err: err})
+	} else if runtimeErr.Thrown {
+		vm.push(runtimeErr.Value)
+	} else {
+		inst := newInstance(vm.errorClass)
+		inst.fields["message"] = runtimeErr.Message
+		inst.fields["line"] = float64(runtimeErr.Line)
+		vm.push(inst)
+	}
+	return true
+}
+
+func (vm *VM) run() error {
+	frame := &vm.frames[len(vm.frames)-1]
+	code := frame.closure.function.Chunk.Code
+	constants := frame.closure.function.Chunk.Constants
+
+	readByte := func() byte {
+		b := code[frame.ip]
+		frame.ip++
+		return b
+	}
+	readOperand := func() int {
+		frame.ip += compiler.OPERAND_SIZE
+		return compiler.ReadOperand(code, frame.ip-compiler.OPERAND_SIZE)
+	}
+	readString := func() string {
+		return constants[readOperand()].(string)
+	}
+	refreshFrame := func() {
+		frame = &vm.frames[len(vm.frames)-1]
+		code = frame.closure.function.Chunk.Code
+		constants = frame.closure.function.Chunk.Constants
+	}
+
+	for {
+		switch compiler.OpCode(readByte()) {
+		case compiler.OP_CONSTANT:
+			vm.push(constants[readOperand()])
+		case compiler.OP_NIL:
+			vm.push(nil)
+		case compiler.OP_TRUE:
+			vm.push(true)
+		case compiler.OP_FALSE:
+			vm.push(false)
+		case compiler.OP_POP:
+			vm.pop()
+		case compiler.OP_GET_LOCAL:
+			vm.push(vm.stack[frame.slots+readOperand()])
+		case compiler.OP_SET_LOCAL:
+			vm.stack[frame.slots+readOperand()] = vm.peek(0)
+		case compiler.OP_GET_GLOBAL:
+			name := readString()
+			value, ok := vm.globals[name]
+			if !ok {
+				return vm.runtimeError(fmt.Sprintf("undefined variable %s", name))
+			}
+			vm.push(value)
+		case compiler.OP_DEFINE_GLOBAL:
+			vm.globals[readString()] = vm.pop()
+		case compiler.OP_SET_GLOBAL:
+			name := readString()
+			if _, ok := vm.globals[name]; !ok {
+				return vm.runtimeError(fmt.Sprintf("undefined variable %s", name))
+			}
+			vm.globals[name] = vm.peek(0)
+		case compiler.OP_GET_UPVALUE:
+			uv := frame.closure.upvalues[readOperand()]
+			if uv.isClosed {
+				vm.push(uv.closed)
+			} else {
+				vm.push(vm.stack[uv.location])
+			}
+		case compiler.OP_SET_UPVALUE:
+			uv := frame.closure.upvalues[readOperand()]
+			if uv.isClosed {
+				uv.closed = vm.peek(0)
+			} else {
+				vm.stack[uv.location] = vm.peek(0)
+			}
+		case compiler.OP_GET_PROPERTY:
+			name := readString()
+			if s, ok := vm.peek(0).(string); ok {
+				property, ok := interpreter.StringProperty(s, name)
+				if !ok {
+					return vm.runtimeError(fmt.Sprintf("undefined property %s", name))
+				}
+				vm.pop()
+				vm.push(property)
+				break
+			}
+			if builtin, ok := vm.peek(0).(interpreter.BuiltinObject); ok {
+				method, ok := builtin.Method(name)
+				if !ok {
+					return vm.runtimeError(fmt.Sprintf("undefined property %s", name))
+				}
+				vm.pop()
+				vm.push(method)
+				break
+			}
+			if ns, ok := vm.peek(0).(*interpreter.Namespace); ok {
+				member, ok := ns.Member(name)
+				if !ok {
+					return vm.runtimeError(fmt.Sprintf("undefined property %s", name))
+				}
+				vm.pop()
+				vm.push(member)
+				break
+			}
+			inst, ok := vm.peek(0).(*instance)
+			if !ok {
+				return vm.runtimeError("only instances have properties")
+			}
+
+			if value, ok := inst.fields[name]; ok {
+				vm.pop()
+				vm.push(value)
+				break
+			}
+			if err := vm.bindMethod(inst.class, name); err != nil {
+				return err
+			}
+		case compiler.OP_CHECK_INSTANCE:
+			if _, ok := vm.peek(0).(*instance); !ok {
+				return vm.runtimeError("only instances have properties")
+			}
+		case compiler.OP_SET_PROPERTY:
+			name := readString()
+			inst := vm.peek(1).(*instance)
+			value := vm.pop()
+			inst.fields[name] = value
+			vm.pop()
+			vm.push(value)
+		case compiler.OP_BUILD_LIST:
+			count := readOperand()
+			elements := make([]any, count)
+			copy(elements, vm.stack[len(vm.stack)-count:])
+			vm.stack = vm.stack[:len(vm.stack)-count]
+			vm.push(interpreter.NewLoxList(elements))
+		case compiler.OP_BUILD_MAP:
+			count := readOperand()
+			entries := vm.stack[len(vm.stack)-2*count:]
+			m := interpreter.NewLoxMap()
+			for i := 0; i < len(entries); i += 2 {
+				if err := m.Set(entries[i], entries[i+1]); err != nil {
+					return vm.runtimeError(err.Error())
+				}
+			}
+			vm.stack = vm.stack[:len(vm.stack)-2*count]
+			vm.push(m)
+		case compiler.OP_GET_INDEX:
+			index := vm.pop()
+			value, err := interpreter.GetIndex(vm.pop(), index)
+			if err != nil {
+				return vm.runtimeError(err.Error())
+			}
+			vm.push(value)
+		case compiler.OP_SET_INDEX:
+			value, index := vm.pop(), vm.pop()
+			if err := interpreter.SetIndex(vm.pop(), index, value); err != nil {
+				return vm.runtimeError(err.Error())
+			}
+			vm.push(value)
+		case compiler.OP_TRY, compiler.OP_TRY_FINALLY:
+			finally := compiler.OpCode(code[frame.ip-1]) == compiler.OP_TRY_FINALLY
+			offset := readOperand()
+			vm.handlers = append(vm.handlers, handler{
+				frameCount:  len(vm.frames),
+				stackHeight: len(vm.stack),
+				ip:          frame.ip + offset,
+				finally:     finally,
+			})
+		case compiler.OP_POP_HANDLER:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case compiler.OP_THROW:
+			return vm.throw(vm.pop())
+		case compiler.OP_RETHROW:
+			return vm.pop().(*pendingError).err
+		case compiler.OP_GET_SUPER:
+			name := readString()
+			superclass := vm.pop().(*class)
+			if err := vm.bindMethod(superclass, name); err != nil {
+				return err
+			}
+		case compiler.OP_EQUAL:
+			b, a := vm.pop(), vm.pop()
+			vm.push(a == b)
+		case compiler.OP_NOT_EQUAL:
+			b, a := vm.pop(), vm.pop()
+			vm.push(a != b)
+		case compiler.OP_GREATER, compiler.OP_GREATER_EQUAL, compiler.OP_LESS, compiler.OP_LESS_EQUAL,
+			compiler.OP_SUBTRACT, compiler.OP_MULTIPLY, compiler.OP_DIVIDE:
+			if err := vm.binaryOp(compiler.OpCode(code[frame.ip-1])); err != nil {
+				return err
+			}
+		case compiler.OP_ADD:
+			if a, ok := vm.peek(1).(string); ok {
+				if b, ok := vm.peek(0).(string); ok {
+					vm.pop()
+					vm.pop()
+					vm.push(a + b)
+					break
+				}
+			}
+			if err := vm.binaryOp(compiler.OP_ADD); err != nil {
+				return err
+			}
+		case compiler.OP_NOT:
+			vm.push(!isTruthy(vm.pop()))
+		case compiler.OP_NEGATE:
+			num, ok := vm.peek(0).(float64)
+			if !ok {
+				return vm.runtimeError("Operand must be a number.")
+			}
+			vm.pop()
+			vm.push(-num)
+		case compiler.OP_PRINT:
+			fmt.Fprintln(vm.stdout, interpreter.Stringify(vm.pop()))
+		case compiler.OP_JUMP:
+			offset := readOperand()
+			frame.ip += offset
+		case compiler.OP_JUMP_IF_FALSE:
+			offset := readOperand()
+			if !isTruthy(vm.peek(0)) {
+				frame.ip += offset
+			}
+		case compiler.OP_LOOP:
+			if err := vm.budget.Spend(frame.closure.function.Chunk.Spans[frame.ip-1]); err != nil {
+				return err
+			}
+			offset := readOperand()
+			frame.ip -= offset
+		case compiler.OP_CALL:
+			argCount := int(readByte())
+			if err := vm.callValue(vm.peek(argCount), argCount); err != nil {
+				return err
+			}
+			refreshFrame()
+		case compiler.OP_CLOSURE:
+			function := constants[readOperand()].(*compiler.Function)
+			cl := newClosure(function)
+			vm.push(cl)
+			for i := range cl.upvalues {
+				isLocal := readByte()
+				index := readOperand()
+				if isLocal == 1 {
+					cl.upvalues[i] = vm.captureUpvalue(frame.slots + index)
+				} else {
+					cl.upvalues[i] = frame.closure.upvalues[index]
+				}
+			}
+		case compiler.OP_CLOSE_UPVALUE:
+			vm.closeUpvalues(len(vm.stack) - 1)
+			vm.pop()
+		case compiler.OP_RETURN:
+			result := vm.pop()
+			vm.closeUpvalues(frame.slots)
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == 0 {
+				vm.stack = vm.stack[:0]
+				return nil
+			}
+
+			vm.stack = vm.stack[:frame.slots]
+			vm.push(result)
+			refreshFrame()
+		case compiler.OP_CLASS:
+			vm.push(newClass(readString()))
+		case compiler.OP_INHERIT:
+			superclass, ok := vm.peek(1).(*class)
+			if !ok {
+				return vm.runtimeError("Superclass must be a class")
+			}
+			subclass := vm.peek(0).(*class)
+			for name, method := range superclass.methods {
+				subclass.methods[name] = method
+			}
+			vm.pop()
+		case compiler.OP_METHOD:
+			name := readString()
+			method := vm.peek(0).(*closure)
+			cls := vm.peek(1).(*class)
+			cls.methods[name] = method
+			vm.pop()
+		default:
+			return fmt.Errorf("unknown opcode %v", compiler.OpCode(code[frame.ip-1]))
+		}
+	}
+}
+
+func (vm *VM) binaryOp(op compiler.OpCode) error {
+	b, bOk := vm.peek(0).(float64)
+	a, aOk := vm.peek(1).(float64)
+	if !aOk || !bOk {
+		return vm.runtimeError("Operands must be numbers.")
+	}
+	vm.pop()
+	vm.pop()
+
+	switch op {
+	case compiler.OP_GREATER:
+		vm.push(a > b)
+	case compiler.OP_GREATER_EQUAL:
+		vm.push(a >= b)
+	case compiler.OP_LESS:
+		vm.push(a < b)
+	case compiler.OP_LESS_EQUAL:
+		vm.push(a <= b)
+	case compiler.OP_ADD:
+		vm.push(a + b)
+	case compiler.OP_SUBTRACT:
+		vm.push(a - b)
+	case compiler.OP_MULTIPLY:
+		vm.push(a * b)
+	case compiler.OP_DIVIDE:
+		vm.push(a / b)
+	}
+	return nil
+}
+
+func (vm *VM) callValue(callee any, argCount int) error {
+	switch callee := callee.(type) {
+	case *closure:
+		return vm.call(callee, argCount)
+	case *class:
+		vm.stack[len(vm.stack)-argCount-1] = newInstance(callee)
+		if initializer, ok := callee.methods["init"]; ok {
+			return vm.call(initializer, argCount)
+		}
+		if argCount != 0 {
+			return vm.arityError(0, argCount)
+		}
+		return vm.spendCall()
+	case *boundMethod:
+		vm.stack[len(vm.stack)-argCount-1] = callee.receiver
+		return vm.call(callee.method, argCount)
+	case *interpreter.NativeFunction:
+		if arity := callee.Arity(); arity != interpreter.VARIADIC && arity != argCount {
+			return vm.arityError(arity, argCount)
+		}
+		args := make([]any, argCount)
+		copy(args, vm.stack[len(vm.stack)-argCount:])
+		result, err := callee.Invoke(vm.budget, args)
+		if err != nil {
+			var runtimeErr interpreter.RuntimeError
+			var exitErr interpreter.ExitError
+			var budgetErr interpreter.BudgetError
+			if errors.As(err, &runtimeErr) || errors.As(err, &exitErr) {
+				return err
+			}
+			if errors.As(err, &budgetErr) {
+				frame := &vm.frames[len(vm.frames)-1]
+				return interpreter.NewBudgetError(frame.closure.function.Chunk.Spans[frame.ip-1], budgetErr.Cause)
+			}
+			return vm.runtimeError(err.Error())
+		}
+		vm.stack = vm.stack[:len(vm.stack)-argCount-1]
+		vm.push(result)
+		return nil
+	default:
+		return vm.runtimeError(fmt.Sprintf("function is not callable: %v", callee))
+	}
+}
+
+// spendCall takes the step a call costs, at the call being made. Running
+// the script itself is free.
+func (vm *VM) spendCall() error {
+	if len(vm.frames) == 0 {
+		return nil
+	}
+	caller := &vm.frames[len(vm.frames)-1]
+	return vm.budget.Spend(caller.closure.function.Chunk.Spans[caller.ip-1])
+}
+
+func (vm *VM) call(cl *closure, argCount int) error {
+	if cl.function.Arity != argCount {
+		return vm.arityError(cl.function.Arity, argCount)
+	}
+	if len(vm.frames)-1 >= vm.maxDepth {
+		return vm.runtimeError("Stack overflow.")
+	}
+	if err := vm.spendCall(); err != nil {
+		return err
+	}
+
+	vm.frames = append(vm.frames, callFrame{
+		closure: cl,
+		ip:      0,
+		slots:   len(vm.stack) - argCount - 1,
+	})
+	return nil
+}
+
+func (vm *VM) bindMethod(cls *class, name string) error {
+	method, ok := cls.methods[name]
+	if !ok {
+		return vm.runtimeError(fmt.Sprintf("undefined property %s", name))
+	}
+
+	bound := &boundMethod{receiver: vm.peek(0), method: method}
+	vm.pop()
+	vm.push(bound)
+	return nil
+}
+
+func (vm *VM) captureUpvalue(location int) *upvalue {
+	var prev *upvalue
+	uv := vm.openUpvalues
+	for uv != nil && uv.location > location {
+		prev = uv
+		uv = uv.next
+	}
+	if uv != nil && uv.location == location {
+		return uv
+	}
+
+	created := &upvalue{location: location, next: uv}
+	if prev == nil {
+		vm.openUpvalues = created
+	} else {
+		prev.next = created
+	}
+	return created
+}
+
+func (vm *VM) closeUpvalues(last int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.location >= last {
+		uv := vm.openUpvalues
+		uv.closed = vm.stack[uv.location]
+		uv.isClosed = true
+		vm.openUpvalues = uv.next
+	}
+}
+
+func (vm *VM) arityError(expected, got int) error {
+	return vm.runtimeError(fmt.Sprintf("expected %d arguments but got %d", expected, got))
+}
+
+func (vm *VM) runtimeError(message string) error {
+	frame := &vm.frames[len(vm.frames)-1]
+	span := frame.closure.function.Chunk.Spans[frame.ip-1]
+	return interpreter.RuntimeError{Message: message, Line: span.Line, Source: span, Trace: vm.trace()}
+}
+
+// trace lists the active calls as the tree-walking interpreter records
+// them: every frame but the script's, with the line it was called from.
+func (vm *VM) trace() []interpreter.Frame {
+	if len(vm.frames) < 2 {
+		return nil
+	}
+
+	trace := make([]interpreter.Frame, 0, len(vm.frames)-1)
+	for k := 1; k < len(vm.frames); k++ {
+		caller := &vm.frames[k-1]
+		function := vm.frames[k].closure.function
+		trace = append(trace, interpreter.Frame{
+			Function: function.Name,
+			Class:    function.ClassName,
+			Line:     caller.closure.function.Chunk.Spans[caller.ip-1].Line,
+		})
+	}
+	return trace
+}
+
+// throw raises value as the tree-walking interpreter's throw statement
+// does, giving an Error instance without a line the current line.
+func (vm *VM) throw(value any) error {
+	frame := &vm.frames[len(vm.frames)-1]
+	span := frame.closure.function.Chunk.Spans[frame.ip-1]
+
+	message := interpreter.Stringify(value)
+	if inst, ok := value.(*instance); ok {
+		if text, ok := inst.fields["message"]; ok {
+			message = interpreter.Stringify(text)
+		}
+		if line, ok := inst.fields["line"]; ok && line == nil {
+			inst.fields["line"] = float64(span.Line)
+		}
+	}
+
+	return interpreter.RuntimeError{Message: message, Line: span.Line, Source: span, Thrown: true, Value: value, Trace: vm.trace()}
+}
+
+func (vm *VM) resetStack() {
+	vm.stack = vm.stack[:0]
+	vm.frames = vm.frames[:0]
+	vm.handlers = vm.handlers[:0]
+	vm.openUpvalues = nil
+}
+
+func (vm *VM) push(value any) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() any {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *VM) peek(distance int) any {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+func isTruthy(v any) bool {
+	if v == nil {
+		return false
+	}
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	return true
+}
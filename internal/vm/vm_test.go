@@ -0,0 +1,179 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/compiler"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/interpreter"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+// run compiles and runs source on a fresh VM, returning what it printed
+// and the error it stopped with. configure, if given, sets up the VM
+// first.
+func run(t *testing.T, source string, configure ...func(*VM)) (string, error) {
+	t.Helper()
+
+	sc := scanner.NewScanner(source)
+	tokens, err := sc.ScanTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, parseErrors := parser.NewParser(tokens).Parse()
+	if len(parseErrors) > 0 {
+		t.Fatal(parseErrors[0])
+	}
+	resolver := interpreter.NewResolver(interpreter.NewInterpreter())
+	if _, err := resolver.Resolve(statements); err != nil {
+		t.Fatal(err)
+	}
+	script, err := compiler.Compile(statements)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout strings.Builder
+	machine := NewVM()
+	machine.SetStdout(&stdout)
+	for _, f := range configure {
+		f(machine)
+	}
+	err = machine.Interpret(script)
+	return stdout.String(), err
+}
+
+func TestInterpret(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		stdout string
+	}{
+		{
+			name:   "closures",
+			source: "fun counter() {\n  var n = 0;\n  return fun () { n = n + 1; return n; };\n}\nvar c = counter();\nc();\nprint c();",
+			stdout: "2\n",
+		},
+		{
+			name:   "classes",
+			source: "class A {\n  init(x) { this.x = x; }\n  get() { return this.x; }\n}\nclass B < A {\n  get() { return super.get() * 2; }\n}\nprint B(21).get();",
+			stdout: "42\n",
+		},
+		{
+			name:   "finally on break",
+			source: "for (var i = 0; i < 3; i = i + 1) {\n  try {\n    if (i == 1) break;\n  } finally {\n    print i;\n  }\n}",
+			stdout: "0\n1\n",
+		},
+		{
+			name:   "caught error",
+			source: "try {\n  nil.x = 1;\n} catch (e) {\n  print e.message;\n}",
+			stdout: "only instances have properties\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdout, err := run(t, test.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stdout != test.stdout {
+				t.Errorf("stdout = %q, want %q", stdout, test.stdout)
+			}
+		})
+	}
+}
+
+// TestOperandLimits runs programs whose locals, upvalues, jumps and
+// constants don't fit in one or two bytes.
+func TestOperandLimits(t *testing.T) {
+	var locals, sum, body, constants strings.Builder
+	for i := range 300 {
+		fmt.Fprintf(&locals, "var v%d = %d;\n", i, i)
+		fmt.Fprintf(&sum, "v%d + ", i)
+	}
+	for range 12000 {
+		body.WriteString("x = x + 1;\n")
+	}
+	for i := range 33000 {
+		fmt.Fprintf(&constants, "var g%d = %d;\n", i, i)
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		stdout string
+	}{
+		{name: "300 locals", source: "{\n" + locals.String() + "print v299 - v0;\n}", stdout: "299\n"},
+		{name: "300 upvalues", source: "{\n" + locals.String() + "fun f() { return " + sum.String() + "0; }\nprint f();\n}", stdout: "44850\n"},
+		{name: "long jump", source: "var x = 0;\nif (x == 1) {\n" + body.String() + "} else {\n" + body.String() + "}\nprint x;", stdout: "12000\n"},
+		{name: "long loop", source: "var x = 0;\nwhile (x < 24000) {\n" + body.String() + "}\nprint x;", stdout: "24000\n"},
+		{name: "33000 globals", source: constants.String() + "print g0 + g32999;", stdout: "32999\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdout, err := run(t, test.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stdout != test.stdout {
+				t.Errorf("stdout = %q, want %q", stdout, test.stdout)
+			}
+		})
+	}
+}
+
+func TestRuntimeError(t *testing.T) {
+	source := "fun f() {\n  return -\"a\";\n}\nf();"
+	_, err := run(t, source)
+	var runtimeErr interpreter.RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("got %v, want a runtime error", err)
+	}
+	if runtimeErr.Message != "Operand must be a number." || runtimeErr.Line != 2 {
+		t.Errorf("got %q on line %d, want %q on line 2", runtimeErr.Message, runtimeErr.Line, "Operand must be a number.")
+	}
+	if len(runtimeErr.Trace) != 1 || runtimeErr.Trace[0].Function != "f" || runtimeErr.Trace[0].Line != 4 {
+		t.Errorf("trace = %+v, want f called from line 4", runtimeErr.Trace)
+	}
+}
+
+func TestMaxSteps(t *testing.T) {
+	source := "var i = 0;\nwhile (true) {\n  i = i + 1;\n  print i;\n}"
+	stdout, err := run(t, source, func(vm *VM) { vm.SetMaxSteps(3) })
+	if !errors.Is(err, interpreter.ErrStepLimit) {
+		t.Fatalf("got %v, want the step limit", err)
+	}
+	if stdout != "1\n2\n3\n4\n" {
+		t.Errorf("stdout = %q, want 4 iterations", stdout)
+	}
+}
+
+func TestReadLineHonoursContext(t *testing.T) {
+	stdin, _ := io.Pipe()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	source := "try {\n  readLine();\n} catch (e) {\n  print \"caught\";\n}"
+	stdout, err := run(t, source, func(vm *VM) {
+		vm.Install(interpreter.System(interpreter.SystemOptions{Stdin: stdin}))
+		vm.SetContext(ctx)
+	})
+	var budgetErr interpreter.BudgetError
+	if !errors.As(err, &budgetErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a budget error caused by the deadline", err)
+	}
+	if budgetErr.Line != 2 {
+		t.Errorf("line = %d, want 2", budgetErr.Line)
+	}
+	if stdout != "" {
+		t.Errorf("stdout = %q, want no output", stdout)
+	}
+}
@@ -0,0 +1,384 @@
+// Package lox embeds the Lox interpreter in Go programs.
+//
+// A VM keeps its globals between calls, so a host can load a script once and
+// then call into it:
+//
+//	vm := lox.New(lox.WithStdout(&buf))
+//	if err := vm.RunFile("greet.lox"); err != nil {
+//		return err
+//	}
+//	greeting, err := vm.Call("greet", "world")
+package lox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/diagnostics"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/interpreter"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+// Value is a Lox value as seen from Go: nil, bool, float64, string,
+// []Value for a list, map[string]Value for a map whose keys are all
+// strings and map[Value]Value for any other map, or an opaque handle to a
+// Lox function, class or instance.
+//
+// Lists and maps are copied when they cross between Lox and Go, so changes
+// made on one side aren't seen on the other.
+type Value = any
+
+// Frame is a Lox function call that was active when a runtime error was
+// raised. Line is the line it was called from.
+type Frame = interpreter.Frame
+
+type ErrorKind int
+
+const (
+	// SyntaxError covers scanning, parsing and resolution errors. No code
+	// from the failing source has run.
+	SyntaxError ErrorKind = iota
+	// RuntimeError is raised while the program runs.
+	RuntimeError
+	// BudgetExceeded stops a program whose context is done or which used
+	// up its step budget. Lox code can't catch it.
+	BudgetExceeded
+)
+
+// Error is returned for errors in Lox source. Multiple syntax errors from a
+// single source are joined with errors.Join.
+type Error struct {
+	Kind    ErrorKind
+	Message string
+	Line    int
+	Column  int
+	// Trace lists the calls active when a runtime error was raised,
+	// outermost first. It is empty for errors raised at the top level.
+	Trace []Frame
+	// File is the path of the imported module a runtime error was raised
+	// in, or empty if it was raised in the VM's own source.
+	File string
+	err  error
+}
+
+func (e *Error) Error() string {
+	return e.err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+type config struct {
+	stdout   io.Writer
+	stderr   io.Writer
+	stdin    io.Reader
+	maxDepth int
+	maxSteps int
+	maxBytes int
+}
+
+type Option func(*config)
+
+// MaxDepth is the largest depth WithMaxDepth allows; larger depths are
+// lowered to it, since deeper recursion would overflow the Go stack.
+const MaxDepth = interpreter.MAX_DEPTH
+
+// WithStdin sets where readLine reads from. It defaults to os.Stdin.
+func WithStdin(r io.Reader) Option {
+	return func(c *config) {
+		c.stdin = r
+	}
+}
+
+// WithStdout sets where print statements write. It defaults to os.Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(c *config) {
+		c.stdout = w
+	}
+}
+
+// WithStderr makes the VM render every error it returns to w, with the
+// offending source line underlined. By default errors are only returned.
+func WithStderr(w io.Writer) Option {
+	return func(c *config) {
+		c.stderr = w
+	}
+}
+
+// WithMaxDepth sets how many Lox calls may be active at once, up to
+// MaxDepth. Deeper calls fail with a "Stack overflow." runtime error.
+func WithMaxDepth(depth int) Option {
+	return func(c *config) {
+		c.maxDepth = depth
+	}
+}
+
+// WithMaxSteps limits how many loop iterations and calls to Lox functions
+// and classes each Eval or Call may take. Other statements and calls to
+// natives aren't counted, so use EvalContext to bound the time they take.
+// By default there is no limit.
+func WithMaxSteps(steps int) Option {
+	return func(c *config) {
+		c.maxSteps = steps
+	}
+}
+
+// WithMaxBytes limits how many bytes each Eval or Call may allocate for
+// strings, instances, environments and closures. Running out raises a
+// runtime error that Lox code may catch. By default there is no limit.
+func WithMaxBytes(bytes int) Option {
+	return func(c *config) {
+		c.maxBytes = bytes
+	}
+}
+
+type VM struct {
+	interpreter interpreter.Interpreter
+	resolver    interpreter.Resolver
+	config      config
+}
+
+// New returns a VM with the builtins and the system natives installed.
+// readLine reads from the configured stdin, while the natives that touch
+// the file system or the environment always fail, and exit stops the
+// program with a runtime error.
+func New(opts ...Option) *VM {
+	cfg := config{stdout: os.Stdout, stdin: os.Stdin, maxDepth: interpreter.DEFAULT_MAX_DEPTH}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	interpreterInstance := interpreter.NewInterpreter()
+	interpreterInstance.SetStdout(cfg.stdout)
+	interpreterInstance.SetMaxDepth(cfg.maxDepth)
+	interpreterInstance.Install(interpreter.System(interpreter.SystemOptions{Stdin: cfg.stdin, Stdout: cfg.stdout}))
+	return &VM{
+		interpreter: interpreterInstance,
+		resolver:    interpreter.NewResolver(interpreterInstance),
+		config:      cfg,
+	}
+}
+
+// Eval runs src in the VM's global scope. If src is a single expression, or
+// ends with an expression statement, Eval returns that expression's value.
+func (vm *VM) Eval(src string) (Value, error) {
+	return vm.EvalContext(context.Background(), src)
+}
+
+// EvalContext is like Eval, but stops the program with a BudgetExceeded
+// error once ctx is done.
+func (vm *VM) EvalContext(ctx context.Context, src string) (Value, error) {
+	sc := scanner.NewScanner(src)
+	tokens, err := sc.ScanTokens()
+	if err != nil {
+		return nil, vm.fail(src, SyntaxError, err)
+	}
+
+	statements, parseErrors := parser.NewParser(tokens).Parse()
+	if len(parseErrors) > 0 {
+		expressions, exprErrors := parser.NewParser(tokens).ParseExpressions()
+		if len(exprErrors) > 0 || len(expressions) != 1 {
+			errs := make([]error, len(parseErrors))
+			for i, parseErr := range parseErrors {
+				errs[i] = vm.fail(src, SyntaxError, parseErr)
+			}
+			return nil, errors.Join(errs...)
+		}
+		statements = []ast.Stmt{&ast.ExpressionStmt{Expr: expressions[0]}}
+	}
+
+	if _, err := vm.resolver.Resolve(statements); err != nil {
+		return nil, vm.fail(src, SyntaxError, err)
+	}
+
+	vm.startBudget(ctx)
+
+	var last ast.Expr
+	if len(statements) > 0 {
+		if exprStmt, ok := statements[len(statements)-1].(*ast.ExpressionStmt); ok {
+			last = exprStmt.Expr
+			statements = statements[:len(statements)-1]
+		}
+	}
+
+	for _, stmt := range statements {
+		if _, err := stmt.Accept(&vm.interpreter); err != nil {
+			return nil, vm.fail(src, RuntimeError, err)
+		}
+	}
+
+	if last == nil {
+		return nil, nil
+	}
+	value, err := vm.interpreter.Interpret(last)
+	if err != nil {
+		return nil, vm.fail(src, RuntimeError, err)
+	}
+	return toGo(value), nil
+}
+
+// RunFile runs the Lox program at path. Its imports are found relative to
+// path.
+func (vm *VM) RunFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	vm.interpreter.SetScriptPath(path)
+
+	_, err = vm.Eval(string(contents))
+	return err
+}
+
+// SetGlobal defines a global variable from a Go value. Numbers of any Go
+// numeric type become Lox numbers, slices become lists and maps become
+// maps; Lox values obtained from the VM are passed through unchanged. Go
+// functions become natives: a func(args ...Value) (Value, error) receives
+// its arguments as is, any other function has them converted as described
+// by interpreter.WrapFunc.
+func (vm *VM) SetGlobal(name string, value any) error {
+	if fn, ok := value.(func(args ...Value) (Value, error)); ok {
+		vm.interpreter.Define(name, interpreter.NewNativeFunction(name, interpreter.VARIADIC, fn))
+		return nil
+	}
+	if value != nil && reflect.TypeOf(value).Kind() == reflect.Func {
+		native, err := interpreter.WrapFunc(name, value)
+		if err != nil {
+			return fmt.Errorf("lox: global %s: %w", name, err)
+		}
+		vm.interpreter.Define(name, native)
+		return nil
+	}
+
+	converted, err := interpreter.FromGo(value)
+	if err != nil {
+		return fmt.Errorf("lox: global %s: %w", name, err)
+	}
+
+	vm.interpreter.Define(name, converted)
+	return nil
+}
+
+// Global returns the current value of a global variable.
+func (vm *VM) Global(name string) (Value, bool) {
+	value, ok := vm.interpreter.Global(name)
+	return toGo(value), ok
+}
+
+// Call invokes the global function or class named fnName.
+func (vm *VM) Call(fnName string, args ...any) (Value, error) {
+	callee, ok := vm.interpreter.Global(fnName)
+	if !ok {
+		return nil, fmt.Errorf("lox: undefined function %s", fnName)
+	}
+
+	arguments := make([]any, len(args))
+	for i, arg := range args {
+		converted, err := interpreter.FromGo(arg)
+		if err != nil {
+			return nil, fmt.Errorf("lox: argument %d to %s: %w", i+1, fnName, err)
+		}
+		arguments[i] = converted
+	}
+
+	vm.startBudget(context.Background())
+	value, err := vm.interpreter.CallValue(callee, arguments)
+	if err != nil {
+		return nil, vm.fail("", RuntimeError, err)
+	}
+	return toGo(value), nil
+}
+
+// toGo converts the lists and maps in a value returned to the host to Go
+// slices and maps. A list or map referred to twice, or from within itself,
+// becomes a single slice or map.
+func toGo(value Value) Value {
+	return convertToGo(value, make(map[any]Value))
+}
+
+func convertToGo(value Value, seen map[any]Value) Value {
+	switch v := value.(type) {
+	case *interpreter.LoxList:
+		if converted, ok := seen[v]; ok {
+			return converted
+		}
+		elements := make([]Value, len(v.Elements))
+		seen[v] = elements
+		for i, element := range v.Elements {
+			elements[i] = convertToGo(element, seen)
+		}
+		return elements
+	case *interpreter.LoxMap:
+		if converted, ok := seen[v]; ok {
+			return converted
+		}
+		keys := v.Keys()
+		if !allStrings(keys) {
+			m := make(map[Value]Value, len(keys))
+			seen[v] = m
+			for _, key := range keys {
+				element, _ := v.Get(key)
+				m[key] = convertToGo(element, seen)
+			}
+			return m
+		}
+		m := make(map[string]Value, len(keys))
+		seen[v] = m
+		for _, key := range keys {
+			element, _ := v.Get(key)
+			m[key.(string)] = convertToGo(element, seen)
+		}
+		return m
+	}
+	return value
+}
+
+func allStrings(keys []Value) bool {
+	for _, key := range keys {
+		if _, ok := key.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// startBudget gives the code about to run a fresh step budget, limited by
+// ctx, and a fresh memory quota.
+func (vm *VM) startBudget(ctx context.Context) {
+	vm.interpreter.SetContext(ctx)
+	vm.interpreter.SetMaxSteps(vm.config.maxSteps)
+	vm.interpreter.SetMaxBytes(vm.config.maxBytes)
+}
+
+func (vm *VM) fail(src string, kind ErrorKind, err error) error {
+	loxErr := &Error{Kind: kind, Message: err.Error(), err: err}
+	if spanned, ok := err.(diagnostics.Spanned); ok {
+		span := spanned.Span()
+		loxErr.Line, loxErr.Column = span.Line, span.Column
+	}
+	var runtimeErr interpreter.RuntimeError
+	if errors.As(err, &runtimeErr) {
+		loxErr.Message = runtimeErr.Message
+		loxErr.Line = runtimeErr.Line
+		loxErr.Trace = runtimeErr.Trace
+		loxErr.File = runtimeErr.File
+	}
+	var budgetErr interpreter.BudgetError
+	if errors.As(err, &budgetErr) {
+		loxErr.Kind = BudgetExceeded
+		loxErr.Message = budgetErr.Message
+		loxErr.Line = budgetErr.Line
+	}
+
+	if vm.config.stderr != nil {
+		diagnostics.NewRenderer(vm.config.stderr, src, diagnostics.COLOR_NEVER).Report(err)
+	}
+	return loxErr
+}
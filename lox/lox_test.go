@@ -0,0 +1,274 @@
+package lox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   Value
+	}{
+		{name: "expression", source: "1 + 2", want: 3.0},
+		{name: "last expression statement", source: "var a = \"lo\";\na + \"x\";", want: "lox"},
+		{name: "no expression", source: "var b = 1;", want: nil},
+		{name: "list", source: "[1, \"a\", [true]]", want: []Value{1.0, "a", []Value{true}}},
+		{name: "map", source: "{\"a\": 1, \"b\": [nil]}", want: map[string]Value{"a": 1.0, "b": []Value{nil}}},
+		{name: "map with other keys", source: "{1: \"one\", \"two\": 2}", want: map[Value]Value{1.0: "one", "two": 2.0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := New(WithStdout(&strings.Builder{}))
+			got, err := vm.Eval(test.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEvalCyclicList(t *testing.T) {
+	vm := New()
+	got, err := vm.Eval("var a = [1];\na.push(a);\na;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, ok := got.([]Value)
+	if !ok || len(list) != 2 {
+		t.Fatalf("got %#v, want a list of 2 elements", got)
+	}
+	if inner, ok := list[1].([]Value); !ok || &inner[0] != &list[0] {
+		t.Errorf("second element is %#v, want the list itself", list[1])
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		kind    ErrorKind
+		message string
+		line    int
+	}{
+		{name: "syntax", source: "var = 1;", kind: SyntaxError, line: 1},
+		{name: "runtime", source: "var a = 1;\nprint -\"a\";", kind: RuntimeError, message: "Operand must be a number.", line: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(WithStdout(&strings.Builder{})).Eval(test.source)
+			var loxErr *Error
+			if !errors.As(err, &loxErr) {
+				t.Fatalf("got %v, want a *lox.Error", err)
+			}
+			if loxErr.Kind != test.kind {
+				t.Errorf("kind = %d, want %d", loxErr.Kind, test.kind)
+			}
+			if test.message != "" && loxErr.Message != test.message {
+				t.Errorf("message = %q, want %q", loxErr.Message, test.message)
+			}
+			if loxErr.Line != test.line {
+				t.Errorf("line = %d, want %d", loxErr.Line, test.line)
+			}
+		})
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"names.lox": "export var names = [\"ada\", \"bob\"];",
+		"main.lox": `from "names.lox" import names;
+fun greet(name) { return "hello " + name; }
+fun greetAll() {
+  var greetings = [];
+  for (var i = 0; i < names.len(); i = i + 1) greetings.push(greet(names[i]));
+  return greetings;
+}
+print greet("world");`,
+	}
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout strings.Builder
+	vm := New(WithStdout(&stdout))
+	if err := vm.RunFile(filepath.Join(dir, "main.lox")); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "hello world\n" {
+		t.Errorf("stdout = %q, want %q", stdout.String(), "hello world\n")
+	}
+
+	got, err := vm.Call("greetAll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Value{"hello ada", "hello bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("greetAll() = %#v, want %#v", got, want)
+	}
+}
+
+func TestSystemNatives(t *testing.T) {
+	vm := New(WithStdin(strings.NewReader("ada\nbob\n")))
+	got, err := vm.Eval("[readLine(), readLine(), readLine()]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Value{"ada", "bob", nil}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	_, err = vm.Eval("readFile(\"/etc/passwd\");")
+	var loxErr *Error
+	if !errors.As(err, &loxErr) || loxErr.Kind != RuntimeError {
+		t.Errorf("got %v, want readFile to fail", err)
+	}
+}
+
+func TestSetGlobal(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		expr  string
+		want  Value
+	}{
+		{name: "int", value: 42, expr: "g + 1", want: 43.0},
+		{name: "slice", value: []string{"a", "b"}, expr: "g.len()", want: 2.0},
+		{name: "nested slice", value: []any{1, []int{2, 3}}, expr: "g[1][0] + g[1][1]", want: 5.0},
+		{name: "map", value: map[string]int{"b": 2, "a": 1}, expr: "g.keys()", want: []Value{"a", "b"}},
+		{name: "map of values", value: map[string]Value{"list": []Value{"x"}}, expr: "g[\"list\"][0]", want: "x"},
+		{name: "function", value: func(a, b int) int { return a * b }, expr: "g(6, 7)", want: 42.0},
+		{name: "function returning a slice", value: func() []string { return []string{"x", "y"} }, expr: "g()", want: []Value{"x", "y"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := New()
+			if err := vm.SetGlobal("g", test.value); err != nil {
+				t.Fatal(err)
+			}
+			got, err := vm.Eval(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s = %#v, want %#v", test.expr, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSetGlobalRejectsUnconvertible(t *testing.T) {
+	if err := New().SetGlobal("g", struct{}{}); err == nil {
+		t.Error("got no error, want one for a struct")
+	}
+	if err := New().SetGlobal("g", []chan int{nil}); err == nil {
+		t.Error("got no error, want one for a slice of channels")
+	}
+}
+
+func TestGlobal(t *testing.T) {
+	vm := New()
+	if _, err := vm.Eval("var scores = {\"ada\": 3};"); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := vm.Global("scores")
+	if !ok {
+		t.Fatal("scores is not defined")
+	}
+	if want := map[string]Value{"ada": 3.0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("scores = %#v, want %#v", got, want)
+	}
+}
+
+func TestCall(t *testing.T) {
+	vm := New()
+	source := `fun total(numbers) {
+  var sum = 0;
+  for (var i = 0; i < numbers.len(); i = i + 1) sum = sum + numbers[i];
+  return sum;
+}
+fun count(words) {
+  var counts = {};
+  for (var i = 0; i < words.len(); i = i + 1) {
+    var word = words[i];
+    if (counts.has(word)) counts[word] = counts[word] + 1;
+    else counts[word] = 1;
+  }
+  return counts;
+}
+fun fail() {
+  return nil + 1;
+}`
+	if _, err := vm.Eval(source); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := vm.Call("total", []float64{1, 2, 3.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 6.5 {
+		t.Errorf("total = %#v, want 6.5", got)
+	}
+
+	got, err = vm.Call("count", []string{"a", "b", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]Value{"a": 2.0, "b": 1.0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("count = %#v, want %#v", got, want)
+	}
+
+	// A list returned to Go can be passed back in.
+	list, err := vm.Eval("[4, 5]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := vm.Call("total", list); err != nil || got != 9.0 {
+		t.Errorf("total = %#v, %v, want 9", got, err)
+	}
+
+	if _, err := vm.Call("missing"); err == nil {
+		t.Error("calling an undefined function succeeded")
+	}
+	if _, err := vm.Call("total", make(chan int)); err == nil {
+		t.Error("calling with a channel succeeded")
+	}
+
+	_, err = vm.Call("fail")
+	var loxErr *Error
+	if !errors.As(err, &loxErr) || loxErr.Kind != RuntimeError || loxErr.Line != 16 {
+		t.Errorf("got %#v, want a runtime error on line 16", err)
+	}
+	if len(loxErr.Trace) != 1 || loxErr.Trace[0].Function != "fail" {
+		t.Errorf("trace = %#v, want the call to fail", loxErr.Trace)
+	}
+}
+
+// TestMaxDepthIsBounded checks that a depth too deep for the Go stack is
+// lowered, so unbounded recursion still raises "Stack overflow.".
+func TestMaxDepthIsBounded(t *testing.T) {
+	vm := New(WithMaxDepth(1000000))
+	_, err := vm.Eval("fun f(n) { return f(n + 1); }\nf(0);")
+	var loxErr *Error
+	if !errors.As(err, &loxErr) || loxErr.Message != "Stack overflow." {
+		t.Fatalf("got %v, want a stack overflow", err)
+	}
+	if len(loxErr.Trace) != MaxDepth {
+		t.Errorf("overflowed at depth %d, want %d", len(loxErr.Trace), MaxDepth)
+	}
+}